@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/admin"
+	"dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/certcacheclient"
+	"dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/certificatecache"
+	"github.com/jetstack/cert-manager/pkg/client/clientset/versioned"
+	"k8s.io/client-go/kubernetes"
+)
+
+// newCacheManager builds the clients and the CertificateCacheManager of the one-shot
+// subcommands. Unlike serve, every failure is returned. Events and metrics are not
+// recorded as the process exits right away.
+func (m *Main) newCacheManager(ctx context.Context) (*certificatecache.CertificateCacheManager, error) {
+	k8sClient, err := m.restConfig()
+	if err != nil {
+		return nil, err
+	}
+	k8sClientSet, err := kubernetes.NewForConfig(k8sClient)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Kubernetes clientset: %w", err)
+	}
+	m.certStore, err = m.newCertStore(ctx, k8sClientSet)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s cache backend: %w", m.flags.CacheBackend, err)
+	}
+	certManagerClient, err := versioned.NewForConfig(k8sClient)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cert-manager client: %w", err)
+	}
+	m.cacheClient, err = certcacheclient.NewForConfig(k8sClient)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create certificate cache client: %w", err)
+	}
+	m.applyDryRun()
+
+	return certificatecache.NewCertificateCacheManager(k8sClientSet, m.certStore, certManagerClient, m.cacheClient, m.flags.CachePolicy, nil, nil, m.plan, m.logger), nil
+}
+
+// reconcileOnce runs every CertificateCacheManager job once, e.g. from a CronJob.
+func (m *Main) reconcileOnce(ctx context.Context) error {
+	ccm, err := m.newCacheManager(ctx)
+	if err != nil {
+		return err
+	}
+
+	jobs := m.cacheJobs(ccm)
+	var errs []error
+	for _, name := range []string{jobCheckAndMark, jobCheckAndCacheCertificates, jobCleanupExpiringCertificates, jobPurgeDeletedSecrets} {
+		m.logger.Infof("Running CertificateCacheManager job %s", name)
+		err := jobs[name](ctx)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("job %s failed: %w", name, err))
+		}
+	}
+	errs = append(errs, m.writePlan())
+	return errors.Join(errs...)
+}
+
+// list prints the cache inventory of the CertificateCache resources.
+func (m *Main) list(ctx context.Context) error {
+	// Only the CertificateCache resources are read, the cache backend is not needed
+	k8sClient, err := m.restConfig()
+	if err != nil {
+		return err
+	}
+	cacheClient, err := certcacheclient.NewForConfig(k8sClient)
+	if err != nil {
+		return fmt.Errorf("failed to create certificate cache client: %w", err)
+	}
+	caches, err := cacheClient.List(ctx, m.flags.Namespace)
+	if err != nil {
+		return err
+	}
+	entries := admin.NewEntries(caches)
+
+	if m.flags.Output == outputJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(entries)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "NAMESPACE\tSECRET\tINGRESS\tPHASE\tNOT AFTER\tSANS")
+	for _, entry := range entries {
+		notAfter := ""
+		if entry.NotAfter != nil {
+			notAfter = entry.NotAfter.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", entry.Namespace, entry.SecretName, entry.IngressName, entry.Phase, notAfter, strings.Join(entry.SANs, ","))
+	}
+	return w.Flush()
+}
+
+// restore writes the cached TLS secrets of an ingress to the cluster.
+func (m *Main) restore(ctx context.Context) error {
+	ccm, err := m.newCacheManager(ctx)
+	if err != nil {
+		return err
+	}
+	err = ccm.RestoreIngress(ctx, m.flags.Namespace, m.flags.Ingress)
+	return errors.Join(err, m.writePlan())
+}
+
+// purge purges the deleted cache entries.
+func (m *Main) purge(ctx context.Context) error {
+	ccm, err := m.newCacheManager(ctx)
+	if err != nil {
+		return err
+	}
+	err = ccm.PurgeDeletedSecrets(ctx)
+	return errors.Join(err, m.writePlan())
+}
+
+// writePlan prints the JSON report of the skipped writes in dry-run mode.
+func (m *Main) writePlan() error {
+	if !m.plan.Enabled() {
+		return nil
+	}
+	return m.plan.WriteJSON(os.Stdout)
+}
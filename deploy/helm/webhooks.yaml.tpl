@@ -19,7 +19,7 @@ webhooks:
         resources: ["challenges", "challenges/status"]
   - name: ingresscerts.drmax.global
     admissionReviewVersions: ["v1"]
-    sideEffects: None
+    sideEffects: NoneOnDryRun
     clientConfig:
       service:
         name: k8s-admission-webhook-drmax
@@ -33,7 +33,7 @@ webhooks:
         resources: ["ingresses"]
   - name: certificatecache.drmax.global
     admissionReviewVersions: ["v1"]
-    sideEffects: None
+    sideEffects: NoneOnDryRun
     clientConfig:
       service:
         name: k8s-admission-webhook-drmax
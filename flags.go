@@ -2,7 +2,15 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"os"
+	"strings"
+	"time"
+
+	azurewrapper "dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/azure"
+	"dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/certificatecache"
+	s3wrapper "dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/s3"
+	vaultwrapper "dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/vault"
 )
 
 // Defaults.
@@ -10,30 +18,188 @@ const (
 	lAddressDef     = ":8080"
 	lMetricsAddress = ":8081"
 	debugDef        = false
+	cacheBackendDef = "keyvault"
+
+	lookupCacheTTLDef         = 5 * time.Minute
+	lookupCacheNegativeTTLDef = 30 * time.Second
+
+	// mutationTimeoutDef stays below the default webhook timeoutSeconds of 10s.
+	mutationTimeoutDef = 8 * time.Second
+)
+
+// Subcommands, serve is used when no subcommand is given.
+const (
+	commandServe         = "serve"
+	commandReconcileOnce = "reconcile-once"
+	commandList          = "list"
+	commandRestore       = "restore"
+	commandPurge         = "purge"
+	commandReplay        = "replay"
+)
+
+// Output formats of the list and replay subcommands.
+const (
+	outputTable = "table"
+	outputJSON  = "json"
 )
 
 // Flags are the flags of the program.
 type Flags struct {
+	Command              string
+	Kubeconfig           string
+	KubeContext          string
 	ListenAddress        string
 	MetricsListenAddress string
 	Debug                bool
 	CertFile             string
 	KeyFile              string
 	KVSafeName           string
+	KeyVault             azurewrapper.KeyVaultConfig
+	CacheBackend         string
+	Vault                vaultwrapper.VaultConfig
+	HubNamespace         string
+	HubKubeconfig        string
+	S3                   s3wrapper.S3Config
+	AdminTokenFile       string
+	CachePolicyFile      string
+	CachePolicy          certificatecache.Policy
+	DryRun               bool
+	LookupCacheTTL       time.Duration
+	LookupNegativeTTL    time.Duration
+	MutationTimeout      time.Duration
+
+	// Subcommand flags.
+	Namespace string
+	Ingress   string
+	Output    string
+	Fixtures  string
+	Webhook   string
+	Reviews   []string
 }
 
-// NewFlags returns the flags of the commandline.
+// NewFlags returns the subcommand and flags of the commandline.
 func NewFlags() *Flags {
-	flags := &Flags{}
-	fl := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	command, args := commandServe, os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+
+	flags := &Flags{Command: command}
+	fl := flag.NewFlagSet(os.Args[0]+" "+command, flag.ExitOnError)
+	switch command {
+	case commandServe, commandReconcileOnce, commandPurge:
+	case commandReplay:
+		fl.StringVar(&flags.Fixtures, "fixtures", "", "comma separated fixture files with the objects and cache entries served to the webhooks")
+		fl.StringVar(&flags.Webhook, "webhook", "", "webhook to replay the reviews through (certorder, ingresscerts, certificatecache, deployment), chosen by kind when empty")
+		fl.StringVar(&flags.Output, "output", outputTable, "output format (table, json)")
+	case commandList:
+		fl.StringVar(&flags.Namespace, "namespace", "", "namespace to list, all namespaces when empty")
+		fl.StringVar(&flags.Output, "output", outputTable, "output format (table, json)")
+	case commandRestore:
+		fl.StringVar(&flags.Namespace, "namespace", "", "namespace of the ingress")
+		fl.StringVar(&flags.Ingress, "ingress", "", "ingress whose TLS secrets are restored from cache")
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q, expected one of %s\n", command, strings.Join([]string{commandServe, commandReconcileOnce, commandList, commandRestore, commandPurge, commandReplay}, ", "))
+		os.Exit(2)
+	}
+
+	fl.StringVar(&flags.Kubeconfig, "kubeconfig", "", "kubeconfig file (defaults to the in-cluster config, then KUBECONFIG or ~/.kube/config)")
+	fl.StringVar(&flags.KubeContext, "context", "", "kubeconfig context (defaults to the current context)")
 	fl.StringVar(&flags.ListenAddress, "listen-address", lAddressDef, "webhook server listen address")
 	fl.StringVar(&flags.MetricsListenAddress, "metrics-listen-address", lMetricsAddress, "metrics server listen address")
 	fl.BoolVar(&flags.Debug, "debug", debugDef, "enable debug mode")
 	fl.StringVar(&flags.CertFile, "tls-cert-file", "certs/cert.pem", "TLS certificate file")
 	fl.StringVar(&flags.KeyFile, "tls-key-file", "certs/key.pem", "TLS key file")
 	fl.StringVar(&flags.KVSafeName, "keyvault-safe-name", "my-safe", "Azure Key Vault safe name")
+	fl.Float64Var(&flags.KeyVault.RateLimit, "keyvault-rate-limit", 20, "Azure Key Vault calls per second")
+	fl.IntVar(&flags.KeyVault.RateBurst, "keyvault-rate-burst", 20, "Azure Key Vault calls allowed at once above the rate limit")
+	fl.IntVar(&flags.KeyVault.MaxRetries, "keyvault-max-retries", 4, "retries of a throttled or failed Azure Key Vault call")
+	fl.IntVar(&flags.KeyVault.BreakerFailures, "keyvault-breaker-failures", 5, "failed Azure Key Vault calls in a row which open the circuit breaker")
+	fl.DurationVar(&flags.KeyVault.BreakerCooldown, "keyvault-breaker-cooldown", 30*time.Second, "time Azure Key Vault calls are rejected once the circuit breaker is open")
+	fl.StringVar(&flags.CacheBackend, "cache-backend", cacheBackendDef, "certificate cache backend (keyvault, vault, hub, s3, memory)")
+	fl.StringVar(&flags.Vault.Address, "vault-address", "", "HashiCorp Vault address (defaults to VAULT_ADDR)")
+	fl.StringVar(&flags.Vault.MountPath, "vault-mount-path", "secret", "HashiCorp Vault KV v2 secrets engine mount path")
+	fl.StringVar(&flags.Vault.PathPrefix, "vault-path-prefix", "certcache", "HashiCorp Vault path prefix for cached certificates")
+	fl.StringVar(&flags.Vault.AuthMethod, "vault-auth-method", vaultwrapper.AuthMethodKubernetes, "HashiCorp Vault auth method (kubernetes, token using VAULT_TOKEN)")
+	fl.StringVar(&flags.Vault.KubernetesRole, "vault-kubernetes-role", "certcache", "HashiCorp Vault role for kubernetes auth")
+	fl.StringVar(&flags.Vault.KubernetesMountPath, "vault-kubernetes-mount-path", "kubernetes", "HashiCorp Vault kubernetes auth mount path")
+	fl.StringVar(&flags.HubNamespace, "hub-namespace", "certificate-cache", "namespace holding the cached certificates as Secrets")
+	fl.StringVar(&flags.HubKubeconfig, "hub-kubeconfig", "", "kubeconfig of a remote hub cluster (defaults to the local cluster)")
+	fl.StringVar(&flags.S3.Endpoint, "s3-endpoint", "s3.amazonaws.com", "S3-compatible endpoint without scheme")
+	fl.StringVar(&flags.S3.Bucket, "s3-bucket", "certcache", "S3 bucket for cached certificates, versioning has to be enabled")
+	fl.StringVar(&flags.S3.Prefix, "s3-prefix", "", "S3 object prefix for cached certificates")
+	fl.StringVar(&flags.S3.Region, "s3-region", "", "S3 region")
+	fl.BoolVar(&flags.S3.Insecure, "s3-insecure", false, "disable TLS towards the S3 endpoint")
+	fl.StringVar(&flags.S3.EncryptionKeyFile, "s3-encryption-key-file", "", "file with a base64 encoded 32 byte key used to encrypt cached certificates")
+	fl.StringVar(&flags.S3.SourceCluster, "cluster-name", "", "name of this cluster recorded on cached certificates")
+
+	fl.BoolVar(&flags.DryRun, "dry-run", false, "log and report the cache writes, Ingress and Certificate mutations and Secrets instead of executing them")
+	fl.DurationVar(&flags.LookupCacheTTL, "lookup-cache-ttl", lookupCacheTTLDef, "how long the webhooks trust a cache backend lookup of an existing certificate (0 disables the lookup cache)")
+	fl.DurationVar(&flags.LookupNegativeTTL, "lookup-cache-negative-ttl", lookupCacheNegativeTTLDef, "how long the webhooks trust a cache backend lookup of a missing certificate (0 disables negative caching)")
+	fl.DurationVar(&flags.MutationTimeout, "mutation-timeout", mutationTimeoutDef, "deadline of the cache backend and API calls of a single admission, has to stay below the timeoutSeconds of the webhook configuration")
+	fl.StringVar(&flags.AdminTokenFile, "admin-token-file", "", "file with the bearer token of the admin API on the metrics listener (admin API is disabled when empty)")
+
+	policyDef := certificatecache.DefaultPolicy()
+	fl.StringVar(&flags.CachePolicyFile, "cache-policy-file", "", "YAML file with the cache thresholds, flags set explicitly take precedence")
+	fl.DurationVar(&flags.CachePolicy.MinValidity, "cache-min-validity", policyDef.MinValidity, "minimum remaining validity of a certificate to be stored in cache")
+	fl.DurationVar(&flags.CachePolicy.EvictBefore, "cache-evict-before", policyDef.EvictBefore, "time before expiry a certificate which was not renewed is evicted from cache")
+	fl.DurationVar(&flags.CachePolicy.RenewBefore, "cache-renew-before", policyDef.RenewBefore, "time before expiry a certificate restored from cache is renewed")
+	fl.DurationVar(&flags.CachePolicy.RestoreMinValidity, "cache-restore-min-validity", policyDef.RestoreMinValidity, "minimum remaining validity of a cached certificate to be restored")
+
+	fl.Parse(args)
+
+	if command == commandRestore && (flags.Namespace == "" || flags.Ingress == "") {
+		fmt.Fprintf(os.Stderr, "restore requires --namespace and --ingress\n")
+		os.Exit(2)
+	}
+	if command == commandReplay {
+		flags.Reviews = fl.Args()
+		if len(flags.Reviews) == 0 {
+			fmt.Fprintf(os.Stderr, "replay requires at least one AdmissionReview file\n")
+			os.Exit(2)
+		}
+	}
+	if (command == commandList || command == commandReplay) && flags.Output != outputTable && flags.Output != outputJSON {
+		fmt.Fprintf(os.Stderr, "unknown output format %q, expected table or json\n", flags.Output)
+		os.Exit(2)
+	}
 
-	fl.Parse(os.Args[1:])
+	if flags.CachePolicyFile != "" {
+		policy, err := certificatecache.LoadPolicyFile(flags.CachePolicyFile, policyDef)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(2)
+		}
+		fl.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "cache-min-validity":
+				policy.MinValidity = flags.CachePolicy.MinValidity
+			case "cache-evict-before":
+				policy.EvictBefore = flags.CachePolicy.EvictBefore
+			case "cache-renew-before":
+				policy.RenewBefore = flags.CachePolicy.RenewBefore
+			case "cache-restore-min-validity":
+				policy.RestoreMinValidity = flags.CachePolicy.RestoreMinValidity
+			}
+		})
+		flags.CachePolicy = policy
+	}
+	if err := flags.CachePolicy.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(2)
+	}
+	if flags.KeyVault.RateLimit <= 0 || flags.KeyVault.RateBurst < 1 || flags.KeyVault.MaxRetries < 0 || flags.KeyVault.BreakerFailures < 1 {
+		fmt.Fprintf(os.Stderr, "--keyvault-rate-limit, --keyvault-rate-burst and --keyvault-breaker-failures must be positive, --keyvault-max-retries must not be negative\n")
+		os.Exit(2)
+	}
+	if flags.LookupCacheTTL < 0 || flags.LookupNegativeTTL < 0 {
+		fmt.Fprintf(os.Stderr, "--lookup-cache-ttl and --lookup-cache-negative-ttl must not be negative\n")
+		os.Exit(2)
+	}
+	if flags.MutationTimeout <= 0 {
+		fmt.Fprintf(os.Stderr, "--mutation-timeout must be positive\n")
+		os.Exit(2)
+	}
 
 	return flags
 }
@@ -2,16 +2,30 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
+	"dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/admin"
 	azurewrapper "dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/azure"
+	certmanagerwrapper "dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/cert-manager-wrapper"
+	"dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/certcacheclient"
 	"dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/certificatecache"
+	"dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/certstore"
+	"dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/health"
 	"dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/k8s"
+	"dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/lifecycle"
+	"dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/metrics"
+	"dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/plan"
+	s3wrapper "dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/s3"
+	"dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/servingcert"
+	vaultwrapper "dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/vault"
 	mutating "dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/webhook/mutation"
 	validating "dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/webhook/validation"
 	"github.com/jetstack/cert-manager/pkg/client/clientset/versioned"
@@ -26,28 +40,52 @@ import (
 	kwhwebhook "github.com/slok/kubewebhook/v2/pkg/webhook"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/leaderelection"
 	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/client-go/tools/record"
 )
 
 const (
-	gracePeriod = 3 * time.Second
-	minReps     = 1
-	maxReps     = 12
+	drainTimeout     = 10 * time.Second
+	readyTimeout     = 5 * time.Second
+	minReps          = 1
+	maxReps          = 12
+	informerResync   = 30 * time.Minute
+	reconcileWorkers = 2
+	certReloadPeriod = 10 * time.Second
+
+	backendProbePeriod  = 30 * time.Second
+	backendProbeTimeout = 5 * time.Second
 )
 
+// backendProbeKey is looked up in the cache backend by the backend probe, it does not have to exist.
+const backendProbeKey = "readyz-probe"
+
 type Main struct {
-	flags  *Flags
-	logger kwhlog.Logger
-	stopC  chan struct{}
+	flags       *Flags
+	logger      kwhlog.Logger
+	k8sClient   kubernetes.Interface
+	certManager *certmanagerwrapper.CertManagerClient
+	certStore   certstore.CertStore
+	cacheClient *certcacheclient.Client
+	promReg     *prometheus.Registry
+	metrics     *metrics.Recorder
+	recorder    record.EventRecorder
+	plan        *plan.Plan
+	informers   *k8s.Informers
+	admin       http.Handler
+	health      *health.Handler
+	backendUp   *health.Result
+	leading     atomic.Bool
 }
 
 // Run will run the main program.
-// Start mux server to handle webhooks and metrics.
-func (m *Main) Run() error {
+// Start mux server to handle webhooks and metrics, together with the components
+// already added to lm, until ctx is cancelled.
+func (m *Main) Run(ctx context.Context, lm *lifecycle.Manager) error {
 	// Create services.
-	promReg := prometheus.NewRegistry()
-	metricsRec, err := kwhprometheus.NewRecorder(kwhprometheus.RecorderConfig{Registry: promReg})
+	metricsRec, err := kwhprometheus.NewRecorder(kwhprometheus.RecorderConfig{Registry: m.promReg})
 	if err != nil {
 		return fmt.Errorf("could not create prometheus recorder: %w", err)
 	}
@@ -55,7 +93,7 @@ func (m *Main) Run() error {
 	// Create webhooks
 
 	//Cert order mutating webhook
-	certOrderMutator, err := mutating.CertOrderMutateWebhook(m.logger)
+	certOrderMutator, err := mutating.CertOrderMutateWebhook(m.logger, m.plan)
 	if err != nil {
 		return err
 	}
@@ -66,7 +104,7 @@ func (m *Main) Run() error {
 	}
 
 	//Ingress certs mutating webhook
-	ingressCertsMutator, err := mutating.IngressCertsMutateWebhook(m.logger, m.flags.KVSafeName)
+	ingressCertsMutator, err := mutating.IngressCertsMutateWebhook(m.logger, m.flags.MutationTimeout, m.certStore, m.cacheClient, m.certManager, m.metrics, m.recorder)
 	if err != nil {
 		return err
 	}
@@ -77,7 +115,7 @@ func (m *Main) Run() error {
 	}
 
 	//Certificate cache mutating webhook
-	certificateCacheMutator, err := mutating.CertificateCacheMutateWebhook(m.logger, m.flags.KVSafeName)
+	certificateCacheMutator, err := mutating.CertificateCacheMutateWebhook(m.logger, m.flags.MutationTimeout, m.k8sClient, m.informers.Ingresses, m.informers.Namespaces, m.certStore, m.cacheClient, m.metrics, m.recorder, m.flags.CachePolicy, m.plan)
 	if err != nil {
 		return err
 	}
@@ -98,70 +136,121 @@ func (m *Main) Run() error {
 		return err
 	}
 
-	// Create the servers and set them listening.
-	errC := make(chan error)
-
-	// Serve webhooks.
-	// TODO: Move to its own service.
-	go func() {
+	// The serving certificate is reloaded when cert-manager rotates it
+	reloader, err := servingcert.NewReloader(m.flags.CertFile, m.flags.KeyFile, m.metrics, m.logger)
+	if err != nil {
+		return err
+	}
+	lm.Add("serving certificate reloader", func(ctx context.Context) error {
+		return reloader.Run(ctx, certReloadPeriod)
+	})
 
+	// Serve webhooks, in-flight admissions are drained on shutdown.
+	mux := http.NewServeMux()
+	mux.Handle("/webhooks/mutating/certorder", certOrderWebHook)
+	mux.Handle("/webhooks/mutating/certificatecache", certificateCacheWebHook)
+	mux.Handle("/webhooks/mutating/ingresscerts", ingressCertsWebHook)
+	mux.Handle("/webhooks/validating/deployment", deploymentReplicasWebhook)
+	webhookServer := &http.Server{
+		Addr:      m.flags.ListenAddress,
+		Handler:   mux,
+		TLSConfig: &tls.Config{GetCertificate: reloader.GetCertificate},
+	}
+	lm.Add("webhook server", lifecycle.HTTPServer(webhookServer, func() error {
 		m.logger.Infof("webhooks listening on %s...", m.flags.ListenAddress)
-		mux := http.NewServeMux()
-		mux.Handle("/webhooks/mutating/certorder", certOrderWebHook)
-		mux.Handle("/webhooks/mutating/certificatecache", certificateCacheWebHook)
-		mux.Handle("/webhooks/mutating/ingresscerts", ingressCertsWebHook)
-		mux.Handle("/webhooks/validating/deployment", deploymentReplicasWebhook)
-		errC <- http.ListenAndServeTLS(
-			m.flags.ListenAddress,
-			m.flags.CertFile,
-			m.flags.KeyFile,
-			mux,
-		)
-	}()
-
-	metricsHandler := promhttp.HandlerFor(promReg, promhttp.HandlerOpts{})
-	go func() {
+		return webhookServer.ListenAndServeTLS("", "")
+	}, drainTimeout))
+
+	metricsMux := http.NewServeMux()
+	metricsMux.Handle("/", promhttp.HandlerFor(m.promReg, promhttp.HandlerOpts{}))
+	metricsMux.Handle("/healthz", m.health)
+	metricsMux.Handle("/readyz", m.health)
+	if m.admin != nil {
+		metricsMux.Handle("/admin/", m.admin)
+	}
+	metricsServer := &http.Server{Addr: m.flags.MetricsListenAddress, Handler: metricsMux}
+	lm.Add("metrics server", lifecycle.HTTPServer(metricsServer, func() error {
 		m.logger.Infof("metrics listening on %s...", m.flags.MetricsListenAddress)
-		errC <- http.ListenAndServe(m.flags.MetricsListenAddress, metricsHandler)
-	}()
+		return metricsServer.ListenAndServe()
+	}, drainTimeout))
 
-	defer m.stop()
+	// Stop reporting ready as soon as shutdown starts
+	context.AfterFunc(ctx, m.health.ShutDown)
 
-	sigC := m.createSignalChan()
-	select {
-	case err := <-errC:
-		if err != nil {
-			m.logger.Errorf("error received: %s", err)
-			return err
-		}
-		m.logger.Infof("app finished successfully")
-	case s := <-sigC:
-		m.logger.Infof("signal %s received", s)
-		return nil
+	err = lm.Run(ctx)
+	if err != nil {
+		return err
 	}
-
+	m.logger.Infof("app finished successfully")
 	return nil
 }
 
-func (m *Main) stop() {
-	m.logger.Infof("stopping everything, waiting %s...", gracePeriod)
-
-	close(m.stopC)
+// newCertStore builds the certificate cache backend selected by flags.
+func (m *Main) newCertStore(ctx context.Context, k8sClientSet *kubernetes.Clientset) (certstore.CertStore, error) {
+	switch m.flags.CacheBackend {
+	case "keyvault":
+		keyVaultClient, err := azurewrapper.NewKeyVaultClient(m.flags.KVSafeName, m.flags.KeyVault, m.metrics, m.logger)
+		if err != nil {
+			return nil, err
+		}
+		return keyVaultClient, nil
+	case "vault":
+		vaultClient, err := vaultwrapper.NewVaultClient(ctx, m.flags.Vault)
+		if err != nil {
+			return nil, err
+		}
+		return vaultClient, nil
+	case "hub":
+		if m.flags.HubKubeconfig == "" {
+			return certstore.NewSecretStore(k8sClientSet, m.flags.HubNamespace), nil
+		}
+		hubConfig, err := k8s.PrepareLocalKubeconfigK8SClient(m.flags.HubKubeconfig)
+		if err != nil {
+			return nil, err
+		}
+		hubClientSet, err := kubernetes.NewForConfig(hubConfig)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create hub cluster clientset: %w", err)
+		}
+		return certstore.NewSecretStore(hubClientSet, m.flags.HubNamespace), nil
+	case "s3":
+		s3Client, err := s3wrapper.NewS3Client(ctx, m.flags.S3)
+		if err != nil {
+			return nil, err
+		}
+		return s3Client, nil
+	case "memory":
+		m.logger.Warningf("Using in-memory cache backend, cached certificates are lost on restart and not shared between replicas")
+		return certstore.NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown cache backend %q", m.flags.CacheBackend)
+	}
+}
 
-	// Stop everything and let them time to stop.
-	time.Sleep(gracePeriod)
+// applyDryRun makes the cache backend and the CertificateCache client record
+// their writes in the plan when --dry-run is set.
+func (m *Main) applyDryRun() {
+	if !m.plan.Enabled() {
+		return
+	}
+	if m.certStore != nil {
+		m.certStore = certstore.NewDryRunStore(m.certStore, m.plan)
+	}
+	if m.cacheClient != nil {
+		m.cacheClient = m.cacheClient.WithPlan(m.plan)
+	}
 }
 
-func (m *Main) createSignalChan() chan os.Signal {
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, syscall.SIGTERM, syscall.SIGINT)
-	return c
+// restConfig returns the config of the kubeconfig and context given by flags,
+// the in-cluster config when both are empty. Every client is built from it.
+func (m *Main) restConfig() (*rest.Config, error) {
+	return k8s.PrepareK8SClient(m.flags.Kubeconfig, m.flags.KubeContext)
 }
 
 func main() {
 	m := Main{
-		flags: NewFlags(),
-		stopC: make(chan struct{}),
+		flags:   NewFlags(),
+		promReg: prometheus.NewRegistry(),
 	}
 
 	logrusLogEntry := logrus.NewEntry(logrus.New())
@@ -171,7 +260,40 @@ func main() {
 		logrusLogEntry.Logger.SetLevel(logrus.InfoLevel)
 	}
 	m.logger = kwhlogrus.NewLogrus(logrusLogEntry)
+	if m.flags.DryRun {
+		m.logger.Warningf("Dry-run mode, cache writes, mutations and Secrets are only reported")
+		m.plan = plan.New(m.logger)
+	}
 
+	// SIGTERM and SIGINT cancel ctx, which stops every component and the
+	// calls of the one-shot subcommands
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	var err error
+	switch m.flags.Command {
+	case commandServe:
+		err = m.serve(ctx)
+	case commandReconcileOnce:
+		err = m.reconcileOnce(ctx)
+	case commandList:
+		err = m.list(ctx)
+	case commandRestore:
+		err = m.restore(ctx)
+	case commandPurge:
+		err = m.purge(ctx)
+	case commandReplay:
+		err = m.replay(ctx)
+	}
+	if err != nil {
+		stop()
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(1)
+	}
+}
+
+// serve runs the webhooks and metrics on every replica and the cache jobs on the leader.
+func (m *Main) serve(ctx context.Context) error {
 	m.logger.Infof("--- DrMax Cluster Controller BootingUp ---")
 
 	if os.Getenv("NAMESPACE") == "" {
@@ -180,39 +302,90 @@ func main() {
 	}
 
 	// Initialize Kubernetes client
-	k8sClient, err := k8s.PrepareInClusterK8SClient()
+	k8sClient, err := m.restConfig()
 	if err != nil {
-		m.logger.Errorf("Failed to create Kubernetes client: %v", err)
+		return fmt.Errorf("failed to create Kubernetes client: %w", err)
 	}
 
 	// Initialize Kubernetes clientset
 	k8sClientSet, err := kubernetes.NewForConfig(k8sClient)
 	if err != nil {
-		m.logger.Errorf("Failed to create Kubernetes clientset: %v", err)
+		return fmt.Errorf("failed to create Kubernetes clientset: %w", err)
+	}
+	m.k8sClient = k8sClientSet
+
+	// Initialize event recorder, cache actions are posted as events on Ingresses and Certificates
+	if !m.plan.Enabled() {
+		var eventBroadcaster record.EventBroadcaster
+		m.recorder, eventBroadcaster = k8s.NewEventRecorder(k8sClientSet)
+		defer eventBroadcaster.Shutdown()
+	}
+
+	// Initialize certificate cache metrics
+	m.metrics, err = metrics.NewRecorder(m.promReg)
+	if err != nil {
+		return fmt.Errorf("failed to create certificate cache metrics: %w", err)
 	}
 
-	// Initialize Key Vault client
-	keyVaultClient, err := azurewrapper.NewKeyVaultClient(m.flags.KVSafeName)
+	// Initialize certificate cache backend
+	certStore, err := m.newCertStore(ctx, k8sClientSet)
 	if err != nil {
-		m.logger.Errorf("Failed to create Key Vault client: %v", err)
+		return fmt.Errorf("failed to create %s cache backend: %w", m.flags.CacheBackend, err)
 	}
+	m.certStore = certstore.NewInstrumentedStore(certStore, m.flags.CacheBackend, m.metrics)
+	if m.flags.LookupCacheTTL > 0 {
+		// Admissions answer from memory, the backend is asked again after the TTL
+		m.certStore = certstore.NewCachedStore(m.certStore, m.flags.LookupCacheTTL, m.flags.LookupNegativeTTL)
+	}
+
 	// Initialize Cert Manager client
 	certManagerClient, err := versioned.NewForConfig(k8sClient)
 	if err != nil {
-		m.logger.Errorf("Failed to create cert-manager client: %v", err)
+		return fmt.Errorf("failed to create cert-manager client: %w", err)
 	}
 
-	ccm := certificatecache.NewCertificateCacheManager(k8sClientSet, keyVaultClient, certManagerClient, m.logger)
+	// Shared informers, the webhooks and the cache jobs read from their listers
+	m.informers = k8s.NewInformers(k8sClientSet, certManagerClient, informerResync)
+	m.certManager = certmanagerwrapper.NewCertManagerClientFromClientset(certManagerClient, k8sClientSet).WithListers(m.informers.Certificates, m.informers.TLSSecrets)
 
-	// Initialize cron
-	c := cron.New()
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+	// Initialize CertificateCache client
+	m.cacheClient, err = certcacheclient.NewForConfig(k8sClient)
+	if err != nil {
+		return fmt.Errorf("failed to create certificate cache client: %w", err)
+	}
+	m.applyDryRun()
+
+	// Readiness requires the API server to be reachable and the informers to be
+	// synced. The cache backend and the Key Vault circuit breaker are only reported,
+	// the webhooks fail open while the backend is down and an unready fleet would
+	// reject every Ingress and Certificate write.
+	m.health = health.NewHandler(readyTimeout)
+	m.health.AddReadinessCheck("apiserver", func(ctx context.Context) error {
+		return k8sClientSet.Discovery().RESTClient().Get().AbsPath("/readyz").Do(ctx).Error()
+	})
+	m.health.AddReadinessCheck("informers", m.informers.Ready)
+	m.backendUp = health.NewResult(fmt.Errorf("cache backend %s not probed yet", m.flags.CacheBackend))
+	m.health.AddReportingCheck("cache-backend", m.backendUp.Check)
+	if keyVaultClient, ok := certStore.(*azurewrapper.KeyVaultClient); ok {
+		m.health.AddReportingCheck("keyvault-circuit", keyVaultClient.CheckCircuit)
+	}
+
+	ccm := certificatecache.NewCertificateCacheManager(k8sClientSet, m.certStore, certManagerClient, m.cacheClient, m.flags.CachePolicy, m.metrics, m.recorder, m.plan, m.logger).
+		WithListers(m.informers.Ingresses, m.informers.Certificates, m.informers.TLSSecrets, m.informers.Namespaces)
+
+	jobs := m.cacheJobs(ccm)
+	if m.flags.AdminTokenFile != "" {
+		token, err := admin.LoadToken(m.flags.AdminTokenFile)
+		if err != nil {
+			return err
+		}
+		m.admin = admin.NewHandler(ccm, m.cacheClient, jobs, m.leading.Load, m.plan, token, m.logger)
+		m.logger.Infof("admin API enabled on %s/admin/", m.flags.MetricsListenAddress)
+	}
 
 	id, err := os.Hostname()
 	if err != nil {
-		m.logger.Errorf("Failed to get hostname: %v", err)
-		os.Exit(1)
+		return fmt.Errorf("failed to get hostname: %w", err)
 	}
 
 	lock := &resourcelock.LeaseLock{
@@ -226,66 +399,195 @@ func main() {
 		},
 	}
 
-	leaderelection.RunOrDie(ctx, leaderelection.LeaderElectionConfig{
-		Lock:          lock,
-		LeaseDuration: 15 * time.Second,
-		RenewDeadline: 10 * time.Second,
-		RetryPeriod:   2 * time.Second,
-		Callbacks: leaderelection.LeaderCallbacks{
-			OnStartedLeading: func(ctx context.Context) {
-				// Only leader should start the cron jobs and run the main logic
-				c.Start()
-
-				// Add CheckAndCacheCertificates job to run every 10 minutes
-				_, err := c.AddFunc("@every 10m", func() {
-					m.logger.Infof("Running CertificateCacheManager - CheckAndCacheCertificates() ")
-					err := ccm.CheckAndCacheCertificates()
-					if err != nil {
-						m.logger.Warningf("Failed to check and cache certificates: %v", err)
-					}
-					m.logger.Infof("Running CertificateCacheManager - CheckAndMark() ")
-					err = ccm.CheckAndMark()
-					if err != nil {
-						m.logger.Warningf("Failed to check and mark certificates: %v", err)
-					}
-				})
-				if err != nil {
-					m.logger.Errorf("Failed to add CheckAndCacheCertificates cron job: %v", err)
-				}
-
-				// Add CleanupExpiringCertificates job to run every 4 hours
-				_, err = c.AddFunc("@every 4h", func() {
-					m.logger.Infof("Running CertificateCacheManager - PurgeDeletedSecrets() ")
-					err := ccm.PurgeDeletedSecrets()
-					if err != nil {
-						m.logger.Warningf("Failed to purge deleted secrets: %v", err)
-					}
-
-					m.logger.Infof("Running CertificateCacheManager - CleanupExpiringCertificates() ")
-					err = ccm.CleanupExpiringCertificates()
-					if err != nil {
-						m.logger.Warningf("Failed to cleanup expiring certificates: %v", err)
-					}
-				})
-				if err != nil {
-					m.logger.Warningf("Failed to add CleanupExpiringCertificates cron job: %v", err)
-				}
-
-				err = m.Run()
-				if err != nil {
-					fmt.Fprintf(os.Stderr, "%s", err)
-					os.Exit(1)
-				}
-				os.Exit(0)
-			},
-			OnStoppedLeading: func() {
-				c.Stop()
-				m.logger.Infof("Lost leadership, stopping application")
-				os.Exit(0)
-			},
-			OnNewLeader: func(identity string) {
-				m.logger.Infof("current elected leader: %s", identity)
+	// Every replica serves webhooks, only the cache jobs are gated by the lease.
+	lm := lifecycle.New(m.logger)
+	lm.Add("informers", m.informers.Run)
+	lm.Add("cache backend probe", func(ctx context.Context) error {
+		m.probeCacheBackend(ctx, certStore)
+		return nil
+	})
+	lm.Add("leader election", func(ctx context.Context) error {
+		m.runLeaderElection(ctx, lock, ccm, jobs)
+		return nil
+	})
+
+	return m.Run(ctx, lm)
+}
+
+// probeCacheBackend looks up backendProbeKey every backendProbePeriod until ctx
+// is cancelled and exports whether the cache backend answered. Outages are
+// logged and reported by /readyz, they do not fail readiness.
+func (m *Main) probeCacheBackend(ctx context.Context, certStore certstore.CertStore) {
+	ticker := time.NewTicker(backendProbePeriod)
+	defer ticker.Stop()
+
+	up := true
+	for {
+		probeCtx, cancel := context.WithTimeout(ctx, backendProbeTimeout)
+		_, err := certStore.SecretExists(probeCtx, backendProbeKey)
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+
+		m.metrics.BackendUp(m.flags.CacheBackend, err == nil)
+		m.backendUp.Set(err)
+		switch {
+		case err != nil && up:
+			m.logger.Warningf("Cache backend %s is unavailable, webhooks fail open until it is back: %v", m.flags.CacheBackend, err)
+		case err == nil && !up:
+			m.logger.Infof("Cache backend %s is available again", m.flags.CacheBackend)
+		}
+		up = err == nil
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runLeaderElection campaigns for the lease until ctx is cancelled. Losing the
+// lease only stops the cache jobs, the replica then campaigns again. It returns
+// once the running cache jobs are finished.
+func (m *Main) runLeaderElection(ctx context.Context, lock resourcelock.Interface, ccm *certificatecache.CertificateCacheManager, jobs map[string]admin.Job) {
+	var running sync.WaitGroup
+	defer running.Wait()
+
+	for ctx.Err() == nil {
+		leaderelection.RunOrDie(ctx, leaderelection.LeaderElectionConfig{
+			Lock:            lock,
+			LeaseDuration:   15 * time.Second,
+			RenewDeadline:   10 * time.Second,
+			RetryPeriod:     2 * time.Second,
+			ReleaseOnCancel: true,
+			Callbacks: leaderelection.LeaderCallbacks{
+				OnStartedLeading: func(ctx context.Context) {
+					running.Add(1)
+					defer running.Done()
+					m.leading.Store(true)
+					defer m.leading.Store(false)
+					m.runCacheJobs(ctx, ccm, jobs)
+				},
+				OnStoppedLeading: func() {
+					m.logger.Infof("Lost leadership, certificate cache jobs are stopped")
+				},
+				OnNewLeader: func(identity string) {
+					m.logger.Infof("current elected leader: %s", identity)
+				},
 			},
-		},
+		})
+	}
+}
+
+// Names of the cache jobs, used as metric label and by the admin API.
+const (
+	jobPurgeDeletedSecrets         = "purge_deleted_secrets"
+	jobCleanupExpiringCertificates = "cleanup_expiring_certificates"
+	jobRecordCacheState            = "record_cache_state"
+	jobCheckAndMark                = "check_and_mark"
+	jobCheckAndCacheCertificates   = "check_and_cache_certificates"
+)
+
+// jobTimeouts bound a single run of the cache jobs, a hanging backend call fails
+// the run instead of blocking the next one. The scheduled runs are cancelled
+// earlier on shutdown or loss of leadership.
+var jobTimeouts = map[string]time.Duration{
+	jobPurgeDeletedSecrets:         time.Hour,
+	jobCleanupExpiringCertificates: time.Hour,
+	jobRecordCacheState:            4 * time.Minute,
+	jobCheckAndMark:                30 * time.Minute,
+	jobCheckAndCacheCertificates:   30 * time.Minute,
+}
+
+// cacheJobs returns the CertificateCacheManager jobs which run on a schedule or
+// on demand through the admin API, measured by the cache metrics.
+func (m *Main) cacheJobs(ccm *certificatecache.CertificateCacheManager) map[string]admin.Job {
+	jobs := map[string]admin.Job{
+		jobPurgeDeletedSecrets:         ccm.PurgeDeletedSecrets,
+		jobCleanupExpiringCertificates: ccm.CleanupExpiringCertificates,
+		jobRecordCacheState:            ccm.RecordCacheState,
+		jobCheckAndMark:                ccm.CheckAndMark,
+		jobCheckAndCacheCertificates:   ccm.CheckAndCacheCertificates,
+	}
+	for name, job := range jobs {
+		name, job := name, job
+		var running sync.Mutex
+		jobs[name] = func(ctx context.Context) error {
+			// A run triggered through the admin API must not overlap the scheduled one
+			if !running.TryLock() {
+				return fmt.Errorf("%s: %w", name, admin.ErrJobRunning)
+			}
+			defer running.Unlock()
+
+			ctx, cancel := context.WithTimeout(ctx, jobTimeouts[name])
+			defer cancel()
+			return m.metrics.RunJob(name, func() error { return job(ctx) })
+		}
+	}
+	return jobs
+}
+
+// runCacheJobs runs the certificate cache reconciler and the CertificateCacheManager
+// cron jobs until ctx is cancelled and waits for the running jobs to finish. The
+// reconciler handles the events of the shared informers, which run on every replica.
+func (m *Main) runCacheJobs(ctx context.Context, ccm *certificatecache.CertificateCacheManager, jobs map[string]admin.Job) {
+	// Ingresses are marked and cached as soon as their certificate becomes ready
+	reconciler, err := certificatecache.NewReconciler(ccm, m.informers.Kube, m.informers.CertManager, m.logger)
+	if err != nil {
+		m.logger.Errorf("Failed to create certificate cache reconciler: %v", err)
+		return
+	}
+
+	reconcilerDone := make(chan struct{})
+	go func() {
+		defer close(reconcilerDone)
+		err := reconciler.Run(ctx, reconcileWorkers)
+		if err != nil {
+			m.logger.Errorf("Certificate cache reconciler failed: %v", err)
+		}
+	}()
+
+	c := cron.New()
+
+	// Add CleanupExpiringCertificates job to run every 4 hours
+	_, err = c.AddFunc("@every 4h", func() {
+		m.logger.Infof("Running CertificateCacheManager - PurgeDeletedSecrets() ")
+		err := jobs[jobPurgeDeletedSecrets](ctx)
+		if err != nil {
+			m.logger.Warningf("Failed to purge deleted secrets: %v", err)
+		}
+
+		m.logger.Infof("Running CertificateCacheManager - CleanupExpiringCertificates() ")
+		err = jobs[jobCleanupExpiringCertificates](ctx)
+		if err != nil {
+			m.logger.Warningf("Failed to cleanup expiring certificates: %v", err)
+		}
 	})
+	if err != nil {
+		m.logger.Warningf("Failed to add CleanupExpiringCertificates cron job: %v", err)
+	}
+
+	// Add RecordCacheState job to refresh the entry metrics every 5 minutes
+	_, err = c.AddFunc("@every 5m", func() {
+		err := jobs[jobRecordCacheState](ctx)
+		if err != nil {
+			m.logger.Warningf("Failed to record certificate cache state: %v", err)
+		}
+	})
+	if err != nil {
+		m.logger.Warningf("Failed to add RecordCacheState cron job: %v", err)
+	}
+
+	m.logger.Infof("Started leading, starting certificate cache jobs")
+	c.Start()
+	<-ctx.Done()
+
+	m.logger.Infof("Stopping certificate cache jobs")
+	<-c.Stop().Done()
+	<-reconcilerDone
+
+	// The new leader exports the cache state, stale series would be counted twice
+	m.metrics.ClearEntries()
 }
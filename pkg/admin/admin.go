@@ -0,0 +1,235 @@
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/apis/certcache/v1alpha1"
+	"dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/certcacheclient"
+	"dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/certificatecache"
+	"dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/certstore"
+	"dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/plan"
+	kwhlog "github.com/slok/kubewebhook/v2/pkg/log"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// Errors of a job run rejected without running it.
+var (
+	// ErrNotLeader is returned by replicas not holding the leader lease, jobs
+	// only run on the leader next to its scheduled runs.
+	ErrNotLeader = errors.New("this replica is not the leader, jobs run on the replica holding the lease")
+	// ErrJobRunning is returned while the job is already running.
+	ErrJobRunning = errors.New("job is already running")
+)
+
+// Job is a cache job which can be triggered on demand. A job run from the admin
+// API is cancelled when the client disconnects.
+type Job func(ctx context.Context) error
+
+// Entry is a cache entry as returned by the admin API.
+type Entry struct {
+	Namespace       string                         `json:"namespace"`
+	SecretName      string                         `json:"secretName"`
+	IngressName     string                         `json:"ingressName,omitempty"`
+	CertificateName string                         `json:"certificateName,omitempty"`
+	Phase           v1alpha1.CertificateCachePhase `json:"phase"`
+	BackendKey      string                         `json:"backendKey,omitempty"`
+	SANs            []string                       `json:"sans,omitempty"`
+	NotAfter        *time.Time                     `json:"notAfter,omitempty"`
+	LastSyncTime    *time.Time                     `json:"lastSyncTime,omitempty"`
+}
+
+// NewEntries converts CertificateCache resources to entries sorted by namespace and secret.
+func NewEntries(caches []v1alpha1.CertificateCache) []Entry {
+	entries := make([]Entry, 0, len(caches))
+	for _, cc := range caches {
+		entry := Entry{
+			Namespace:       cc.Namespace,
+			SecretName:      cc.Spec.SecretName,
+			IngressName:     cc.Spec.IngressName,
+			CertificateName: cc.Spec.CertificateName,
+			Phase:           cc.Status.Phase,
+			BackendKey:      cc.Status.BackendKey,
+			SANs:            cc.Status.SANs,
+		}
+		if cc.Status.NotAfter != nil {
+			entry.NotAfter = &cc.Status.NotAfter.Time
+		}
+		if cc.Status.LastSyncTime != nil {
+			entry.LastSyncTime = &cc.Status.LastSyncTime.Time
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Namespace != entries[j].Namespace {
+			return entries[i].Namespace < entries[j].Namespace
+		}
+		return entries[i].SecretName < entries[j].SecretName
+	})
+	return entries
+}
+
+// Handler serves the admin API. Every request has to carry the admin token as a
+// bearer token.
+type Handler struct {
+	mux         *http.ServeMux
+	ccm         *certificatecache.CertificateCacheManager
+	cacheClient *certcacheclient.Client
+	jobs        map[string]Job
+	isLeader    func() bool
+	plan        *plan.Plan
+	token       []byte
+	logger      kwhlog.Logger
+}
+
+// LoadToken reads the admin token from a file.
+func LoadToken(tokenFile string) ([]byte, error) {
+	token, err := os.ReadFile(tokenFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read admin token: %w", err)
+	}
+	token = []byte(strings.TrimSpace(string(token)))
+	if len(token) == 0 {
+		return nil, fmt.Errorf("admin token file %s is empty", tokenFile)
+	}
+	return token, nil
+}
+
+// NewHandler returns the admin API handler, routes are registered under /admin/.
+// Jobs are only run while isLeader reports the replica holds the leader lease.
+func NewHandler(ccm *certificatecache.CertificateCacheManager, cacheClient *certcacheclient.Client, jobs map[string]Job, isLeader func() bool, p *plan.Plan, token []byte, logger kwhlog.Logger) *Handler {
+	h := &Handler{
+		mux:         http.NewServeMux(),
+		ccm:         ccm,
+		cacheClient: cacheClient,
+		jobs:        jobs,
+		isLeader:    isLeader,
+		plan:        p,
+		token:       token,
+		logger:      logger,
+	}
+	h.mux.HandleFunc("GET /admin/entries", h.listEntries)
+	h.mux.HandleFunc("GET /admin/entries/{namespace}", h.listEntries)
+	h.mux.HandleFunc("DELETE /admin/entries/{namespace}/{secret}", h.evictEntry)
+	h.mux.HandleFunc("POST /admin/ingresses/{namespace}/{name}/recache", h.recacheIngress)
+	h.mux.HandleFunc("GET /admin/jobs", h.listJobs)
+	h.mux.HandleFunc("POST /admin/jobs/{job}", h.runJob)
+	h.mux.HandleFunc("GET /admin/plan", h.getPlan)
+	return h
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !h.authenticated(r) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+		writeError(w, http.StatusUnauthorized, fmt.Errorf("unauthorized"))
+		return
+	}
+	h.mux.ServeHTTP(w, r)
+}
+
+func (h *Handler) authenticated(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), h.token) == 1
+}
+
+func (h *Handler) listEntries(w http.ResponseWriter, r *http.Request) {
+	caches, err := h.cacheClient.List(r.Context(), r.PathValue("namespace"))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, NewEntries(caches))
+}
+
+func (h *Handler) evictEntry(w http.ResponseWriter, r *http.Request) {
+	namespace, secretName := r.PathValue("namespace"), r.PathValue("secret")
+	h.logger.Infof("admin API: evicting secret %s in namespace %s", secretName, namespace)
+
+	err := h.ccm.EvictSecret(r.Context(), namespace, secretName)
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) recacheIngress(w http.ResponseWriter, r *http.Request) {
+	namespace, name := r.PathValue("namespace"), r.PathValue("name")
+	h.logger.Infof("admin API: re-caching ingress %s in namespace %s", name, namespace)
+
+	err := h.ccm.RecacheIngress(r.Context(), namespace, name)
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) listJobs(w http.ResponseWriter, _ *http.Request) {
+	jobs := make([]string, 0, len(h.jobs))
+	for name := range h.jobs {
+		jobs = append(jobs, name)
+	}
+	sort.Strings(jobs)
+	writeJSON(w, http.StatusOK, jobs)
+}
+
+func (h *Handler) runJob(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("job")
+	job, ok := h.jobs[name]
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("unknown job %q", name))
+		return
+	}
+	if !h.isLeader() {
+		writeError(w, http.StatusServiceUnavailable, ErrNotLeader)
+		return
+	}
+	h.logger.Infof("admin API: running job %s", name)
+
+	err := job(r.Context())
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getPlan returns the writes skipped so far in dry-run mode.
+func (h *Handler) getPlan(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = h.plan.WriteJSON(w)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// errorStatus maps the error of a request to a status code, a throttled or
+// unavailable cache backend is a 503 so the request can be retried later.
+func errorStatus(err error) int {
+	switch {
+	case apierrors.IsNotFound(err):
+		return http.StatusNotFound
+	case certstore.IsTransient(err):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, ErrJobRunning):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
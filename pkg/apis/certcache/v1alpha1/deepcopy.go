@@ -0,0 +1,72 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func (in *CertificateCache) DeepCopyInto(out *CertificateCache) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	out.Spec = in.Spec
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+func (in *CertificateCache) DeepCopy() *CertificateCache {
+	if in == nil {
+		return nil
+	}
+	out := new(CertificateCache)
+	in.DeepCopyInto(out)
+	return out
+}
+
+func (in *CertificateCache) DeepCopyObject() runtime.Object {
+	return in.DeepCopy()
+}
+
+func (in *CertificateCacheStatus) DeepCopyInto(out *CertificateCacheStatus) {
+	*out = *in
+	if in.LastSyncTime != nil {
+		out.LastSyncTime = in.LastSyncTime.DeepCopy()
+	}
+	if in.NotAfter != nil {
+		out.NotAfter = in.NotAfter.DeepCopy()
+	}
+	if in.SANs != nil {
+		out.SANs = make([]string, len(in.SANs))
+		copy(out.SANs, in.SANs)
+	}
+	if in.Conditions != nil {
+		out.Conditions = make([]metav1.Condition, len(in.Conditions))
+		for i := range in.Conditions {
+			in.Conditions[i].DeepCopyInto(&out.Conditions[i])
+		}
+	}
+}
+
+func (in *CertificateCacheList) DeepCopyInto(out *CertificateCacheList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		out.Items = make([]CertificateCache, len(in.Items))
+		for i := range in.Items {
+			in.Items[i].DeepCopyInto(&out.Items[i])
+		}
+	}
+}
+
+func (in *CertificateCacheList) DeepCopy() *CertificateCacheList {
+	if in == nil {
+		return nil
+	}
+	out := new(CertificateCacheList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+func (in *CertificateCacheList) DeepCopyObject() runtime.Object {
+	return in.DeepCopy()
+}
@@ -0,0 +1,110 @@
+package v1alpha1
+
+import (
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// CertificateCachePhase is the lifecycle phase of a cached TLS secret.
+type CertificateCachePhase string
+
+const (
+	// PhasePending waits for the Certificate to become ready.
+	PhasePending CertificateCachePhase = "Pending"
+	// PhaseScheduled is ready and waits to be stored in the cache backend.
+	PhaseScheduled CertificateCachePhase = "Scheduled"
+	// PhaseCached is stored in the cache backend.
+	PhaseCached CertificateCachePhase = "Cached"
+	// PhaseExpiring waits for cert-manager to renew a certificate too close to expiry to be cached.
+	PhaseExpiring CertificateCachePhase = "Expiring"
+	// PhaseEvicted was removed from the cache backend after it expired without being renewed.
+	PhaseEvicted CertificateCachePhase = "Evicted"
+	// PhaseError failed to be stored, it is retried.
+	PhaseError CertificateCachePhase = "Error"
+)
+
+// ConditionCached reports whether the secret is currently stored in the cache backend.
+const ConditionCached = "Cached"
+
+// Condition reasons.
+const (
+	ReasonCertificateNotReady = "CertificateNotReady"
+	ReasonScheduled           = "ScheduledForSave"
+	ReasonStored              = "StoredInCache"
+	ReasonRenewed             = "RenewedInCache"
+	ReasonRestored            = "RestoredFromCache"
+	ReasonFoundInCache        = "FoundInCache"
+	ReasonExpiring            = "CertificateExpiring"
+	ReasonEvicted             = "EvictedForExpiry"
+	ReasonEvictedByAdmin      = "EvictedByAdmin"
+	ReasonMissingFromCache    = "MissingFromCache"
+	ReasonCorrupt             = "CorruptInCache"
+	ReasonBackendError        = "BackendError"
+	ReasonMigrated            = "MigratedFromAnnotations"
+)
+
+// CertificateCache tracks the cache state of a single Ingress TLS secret.
+type CertificateCache struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   CertificateCacheSpec   `json:"spec"`
+	Status CertificateCacheStatus `json:"status,omitempty"`
+}
+
+type CertificateCacheSpec struct {
+	// SecretName is the TLS secret in the same namespace.
+	SecretName string `json:"secretName"`
+	// IngressName is the Ingress referencing the secret in spec.tls.
+	IngressName string `json:"ingressName,omitempty"`
+	// CertificateName is the cert-manager Certificate issuing the secret.
+	CertificateName string `json:"certificateName,omitempty"`
+}
+
+type CertificateCacheStatus struct {
+	Phase        CertificateCachePhase `json:"phase,omitempty"`
+	LastSyncTime *metav1.Time          `json:"lastSyncTime,omitempty"`
+	// BackendKey is the key the secret is stored under in the cache backend.
+	BackendKey string       `json:"backendKey,omitempty"`
+	NotAfter   *metav1.Time `json:"notAfter,omitempty"`
+	SANs       []string     `json:"sans,omitempty"`
+	// SerialNumber of the cached certificate, used to detect renewals.
+	SerialNumber string             `json:"serialNumber,omitempty"`
+	Conditions   []metav1.Condition `json:"conditions,omitempty"`
+}
+
+type CertificateCacheList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []CertificateCache `json:"items"`
+}
+
+// CachedReason returns the reason of the last Cached condition transition.
+func (s *CertificateCacheStatus) CachedReason() string {
+	condition := meta.FindStatusCondition(s.Conditions, ConditionCached)
+	if condition == nil {
+		return ""
+	}
+	return condition.Reason
+}
+
+// SetPhase moves the status to the phase and records the reason on the Cached condition.
+func (s *CertificateCacheStatus) SetPhase(phase CertificateCachePhase, reason, message string) {
+	s.Phase = phase
+	status := metav1.ConditionFalse
+	if phase == PhaseCached {
+		status = metav1.ConditionTrue
+	}
+	meta.SetStatusCondition(&s.Conditions, metav1.Condition{
+		Type:    ConditionCached,
+		Status:  status,
+		Reason:  reason,
+		Message: message,
+	})
+}
+
+// WantsCaching reports whether the secret is ready and waits to be stored.
+func (s *CertificateCacheStatus) WantsCaching() bool {
+	return s.Phase == PhaseScheduled || s.Phase == PhaseExpiring || s.Phase == PhaseError
+}
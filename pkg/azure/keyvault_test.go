@@ -0,0 +1,87 @@
+package azurewrapper
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func testCertificatePEM(t *testing.T, commonName string) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func TestParseCertAndKey(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sec1, err := x509.MarshalECPrivateKey(ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: sec1})
+	pkcs8PEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8})
+	rsaPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)})
+
+	leaf := testCertificatePEM(t, "shop.example.com")
+	intermediate := testCertificatePEM(t, "Example Intermediate")
+	chain := append(append([]byte{}, leaf...), intermediate...)
+
+	tests := []struct {
+		name     string
+		value    string
+		wantCert []byte
+		wantKey  []byte
+	}{
+		{name: "pkcs8", value: string(leaf) + "\n" + string(pkcs8PEM), wantCert: leaf, wantKey: pkcs8PEM},
+		{name: "pkcs1 rsa", value: string(leaf) + "\n" + string(rsaPEM), wantCert: leaf, wantKey: rsaPEM},
+		{name: "sec1 ec", value: string(leaf) + "\n" + string(ecPEM), wantCert: leaf, wantKey: ecPEM},
+		{name: "chain", value: string(chain) + "\n" + string(ecPEM), wantCert: chain, wantKey: ecPEM},
+		{name: "key first", value: string(ecPEM) + string(chain), wantCert: chain, wantKey: ecPEM},
+		{name: "missing key", value: string(chain) + "\n", wantCert: chain},
+		{name: "no pem", value: "not a certificate"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cert, key := parseCertAndKey([]byte(tt.value))
+			if !bytes.Equal(cert, tt.wantCert) {
+				t.Errorf("cert = %q, want %q", cert, tt.wantCert)
+			}
+			if !bytes.Equal(key, tt.wantKey) {
+				t.Errorf("key = %q, want %q", key, tt.wantKey)
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package azurewrapper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/certstore"
+	"dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/resilience"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+)
+
+// backendName labels the Key Vault metrics, as selected by --cache-backend.
+const backendName = "keyvault"
+
+// Reasons of a retried call.
+const (
+	retryThrottled   = "throttled"
+	retryUnavailable = "unavailable"
+)
+
+const (
+	backoffInitial = 500 * time.Millisecond
+	backoffMax     = 10 * time.Second
+)
+
+// KeyVaultConfig limits the calls to Key Vault and retries the throttled and failed ones.
+type KeyVaultConfig struct {
+	// RateLimit is the sustained number of calls per second, RateBurst the calls allowed at once.
+	RateLimit float64
+	RateBurst int
+	// MaxRetries of a throttled or failed call, the delay grows exponentially
+	// and is at least the Retry-After sent by Key Vault.
+	MaxRetries int
+	// BreakerFailures failed calls in a row open the circuit breaker, calls are
+	// then rejected without reaching Key Vault for BreakerCooldown.
+	BreakerFailures int
+	BreakerCooldown time.Duration
+}
+
+// Recorder records the retries and the circuit breaker state of the client.
+type Recorder interface {
+	BackendRetry(backend, reason string)
+	BackendCircuitState(backend string, state resilience.State)
+}
+
+// call runs fn within the rate limit and retries it while Key Vault is throttling
+// or unavailable. While the circuit breaker is open it fails without calling fn,
+// so the webhooks fail open fast and the cache jobs stop hammering the vault.
+// The returned error carries the certstore kind of the last failure.
+func (kvc *KeyVaultClient) call(ctx context.Context, fn func(ctx context.Context) error) error {
+	return typedError(kvc.retry(ctx, fn))
+}
+
+func (kvc *KeyVaultClient) retry(ctx context.Context, fn func(ctx context.Context) error) error {
+	for retry := 0; ; retry++ {
+		err := kvc.breaker.Allow()
+		if err != nil {
+			return certstore.NewError(certstore.ErrUnavailable, fmt.Errorf("key vault is unavailable: %w", err))
+		}
+		err = kvc.limiter.Wait(ctx)
+		if err != nil {
+			kvc.breaker.Release()
+			return certstore.NewError(certstore.ErrThrottled, fmt.Errorf("failed to wait for key vault rate limit: %w", err))
+		}
+
+		err = fn(ctx)
+		reason, retryAfter := classify(err)
+		switch {
+		case errors.Is(err, context.Canceled):
+			kvc.breaker.Release()
+		case reason == "" && !errors.Is(err, context.DeadlineExceeded):
+			// Key Vault answered, also a not found or forbidden is an answer
+			kvc.breaker.Success()
+		default:
+			kvc.breaker.Failure()
+		}
+		if reason == "" || retry >= kvc.backoff.MaxRetries {
+			return err
+		}
+
+		delay := max(kvc.backoff.Delay(retry), retryAfter)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return err
+		}
+		kvc.recorder.BackendRetry(backendName, reason)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// classify returns why a failed call can be retried and the delay Key Vault asked
+// for, the reason is empty when the call must not be retried.
+func classify(err error) (string, time.Duration) {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return "", 0
+	}
+
+	var respErr *azcore.ResponseError
+	if !errors.As(err, &respErr) {
+		// Connection and authentication failures
+		return retryUnavailable, 0
+	}
+	var retryAfter time.Duration
+	if respErr.RawResponse != nil {
+		retryAfter = resilience.RetryAfter(respErr.RawResponse.Header)
+	}
+	switch respErr.StatusCode {
+	case http.StatusTooManyRequests:
+		return retryThrottled, retryAfter
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return retryUnavailable, retryAfter
+	}
+	return "", 0
+}
+
+// typedError gives the error of a call its certstore kind. Connection and
+// authentication failures are unavailable, a cancelled call has no kind.
+func typedError(err error) error {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return err
+	}
+	var respErr *azcore.ResponseError
+	if !errors.As(err, &respErr) {
+		return certstore.NewError(certstore.ErrUnavailable, err)
+	}
+	switch {
+	case respErr.StatusCode == http.StatusNotFound:
+		return certstore.NewError(certstore.ErrNotFound, err)
+	case respErr.StatusCode == http.StatusUnauthorized || respErr.StatusCode == http.StatusForbidden:
+		return certstore.NewError(certstore.ErrForbidden, err)
+	case respErr.StatusCode == http.StatusTooManyRequests:
+		return certstore.NewError(certstore.ErrThrottled, err)
+	case respErr.StatusCode >= http.StatusInternalServerError:
+		return certstore.NewError(certstore.ErrUnavailable, err)
+	}
+	return err
+}
+
+// CheckCircuit is a readiness check reporting an open circuit breaker.
+func (kvc *KeyVaultClient) CheckCircuit(_ context.Context) error {
+	if state := kvc.breaker.State(); state == resilience.StateOpen {
+		return fmt.Errorf("key vault %w", resilience.ErrOpen)
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+package azurewrapper
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/certstore"
+	"dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/resilience"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"golang.org/x/time/rate"
+)
+
+type fakeRecorder struct {
+	retries []string
+	states  []resilience.State
+}
+
+func (r *fakeRecorder) BackendRetry(_, reason string) { r.retries = append(r.retries, reason) }
+
+func (r *fakeRecorder) BackendCircuitState(_ string, state resilience.State) {
+	r.states = append(r.states, state)
+}
+
+func newTestClient(maxRetries, breakerFailures int) (*KeyVaultClient, *fakeRecorder) {
+	recorder := &fakeRecorder{}
+	kvc := &KeyVaultClient{
+		limiter:  rate.NewLimiter(rate.Inf, 1),
+		backoff:  resilience.Backoff{Initial: time.Millisecond, Max: 2 * time.Millisecond, MaxRetries: maxRetries},
+		recorder: recorder,
+	}
+	kvc.breaker = resilience.NewBreaker(breakerFailures, time.Hour, func(state resilience.State) {
+		recorder.BackendCircuitState(backendName, state)
+	})
+	return kvc, recorder
+}
+
+func responseError(status int) error {
+	return &azcore.ResponseError{StatusCode: status}
+}
+
+func TestCall(t *testing.T) {
+	tests := []struct {
+		name        string
+		errs        []error
+		wantCalls   int
+		wantKind    error
+		wantRetries []string
+		wantState   resilience.State
+	}{
+		{
+			name:      "success",
+			errs:      []error{nil},
+			wantCalls: 1,
+			wantState: resilience.StateClosed,
+		},
+		{
+			name:        "throttled then success",
+			errs:        []error{responseError(http.StatusTooManyRequests), nil},
+			wantCalls:   2,
+			wantRetries: []string{retryThrottled},
+			wantState:   resilience.StateClosed,
+		},
+		{
+			name:        "unavailable until the retries are used up",
+			errs:        []error{responseError(http.StatusServiceUnavailable), responseError(http.StatusBadGateway), errors.New("connection refused")},
+			wantCalls:   3,
+			wantKind:    certstore.ErrUnavailable,
+			wantRetries: []string{retryUnavailable, retryUnavailable},
+			wantState:   resilience.StateOpen,
+		},
+		{
+			name:      "not found is not retried",
+			errs:      []error{responseError(http.StatusNotFound)},
+			wantCalls: 1,
+			wantKind:  certstore.ErrNotFound,
+			wantState: resilience.StateClosed,
+		},
+		{
+			name:      "forbidden is not retried",
+			errs:      []error{responseError(http.StatusForbidden)},
+			wantCalls: 1,
+			wantKind:  certstore.ErrForbidden,
+			wantState: resilience.StateClosed,
+		},
+		{
+			name:      "cancelled is not retried and has no kind",
+			errs:      []error{context.Canceled},
+			wantCalls: 1,
+			wantState: resilience.StateClosed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kvc, recorder := newTestClient(2, 3)
+
+			calls := 0
+			err := kvc.call(context.Background(), func(context.Context) error {
+				err := tt.errs[calls]
+				calls++
+				return err
+			})
+
+			if calls != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", calls, tt.wantCalls)
+			}
+			if tt.wantKind == nil && certstore.Kind(err) != nil {
+				t.Errorf("error kind = %v, want none", certstore.Kind(err))
+			}
+			if tt.wantKind != nil && !errors.Is(err, tt.wantKind) {
+				t.Errorf("error = %v, want kind %v", err, tt.wantKind)
+			}
+			if len(recorder.retries) != len(tt.wantRetries) {
+				t.Errorf("retries = %v, want %v", recorder.retries, tt.wantRetries)
+			}
+			if state := kvc.breaker.State(); state != tt.wantState {
+				t.Errorf("breaker state = %s, want %s", state, tt.wantState)
+			}
+		})
+	}
+}
+
+func TestCallOpenBreaker(t *testing.T) {
+	kvc, recorder := newTestClient(0, 1)
+
+	err := kvc.call(context.Background(), func(context.Context) error { return responseError(http.StatusInternalServerError) })
+	if !errors.Is(err, certstore.ErrUnavailable) {
+		t.Fatalf("error = %v, want unavailable", err)
+	}
+
+	called := false
+	err = kvc.call(context.Background(), func(context.Context) error {
+		called = true
+		return nil
+	})
+	if called {
+		t.Error("call reached key vault while the breaker is open")
+	}
+	if !errors.Is(err, certstore.ErrUnavailable) || !errors.Is(err, resilience.ErrOpen) {
+		t.Errorf("error = %v, want unavailable circuit breaker is open", err)
+	}
+	want := []resilience.State{resilience.StateClosed, resilience.StateOpen}
+	if len(recorder.states) != len(want) || recorder.states[1] != want[1] {
+		t.Errorf("state changes = %v, want %v", recorder.states, want)
+	}
+}
+
+func TestCallDeadline(t *testing.T) {
+	kvc, _ := newTestClient(5, 10)
+	kvc.backoff.Initial, kvc.backoff.Max = time.Hour, time.Hour
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	calls := 0
+	err := kvc.call(ctx, func(context.Context) error {
+		calls++
+		return responseError(http.StatusServiceUnavailable)
+	})
+	if calls != 1 {
+		t.Errorf("calls = %d, want 1, the delay exceeds the deadline", calls)
+	}
+	if !errors.Is(err, certstore.ErrUnavailable) {
+		t.Errorf("error = %v, want unavailable", err)
+	}
+}
+
+func TestCheckCircuit(t *testing.T) {
+	kvc, _ := newTestClient(0, 1)
+	if err := kvc.CheckCircuit(context.Background()); err != nil {
+		t.Fatalf("CheckCircuit() = %v with a closed breaker", err)
+	}
+
+	_ = kvc.call(context.Background(), func(context.Context) error { return responseError(http.StatusServiceUnavailable) })
+	if err := kvc.CheckCircuit(context.Background()); !errors.Is(err, resilience.ErrOpen) {
+		t.Errorf("CheckCircuit() = %v with an open breaker, want %v", err, resilience.ErrOpen)
+	}
+}
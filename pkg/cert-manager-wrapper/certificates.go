@@ -2,44 +2,198 @@ package certmanagerwrapper
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
-	"dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/k8s"
-
 	certmanagerv1 "github.com/jetstack/cert-manager/pkg/apis/certmanager/v1"
 	cmmeta "github.com/jetstack/cert-manager/pkg/apis/meta/v1"
 	"github.com/jetstack/cert-manager/pkg/client/clientset/versioned"
+	cmlisters "github.com/jetstack/cert-manager/pkg/client/listers/certmanager/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/rest"
+)
+
+// CertificateNameAnnotation is set by cert-manager on every Secret it issues.
+const CertificateNameAnnotation = "cert-manager.io/certificate-name"
+
+// Expected outcomes of a lookup while cert-manager has not issued the secret yet,
+// any other error means the Certificates or Secrets could not be read.
+var (
+	// ErrCertificateNotFound is returned when no Certificate issues the secret.
+	ErrCertificateNotFound = errors.New("no certificate found")
+	// ErrCertificateNotReady is returned when the Certificate is not ready.
+	ErrCertificateNotReady = errors.New("certificate is not ready")
 )
 
+// IsNotIssued reports whether the secret is not issued yet, the Certificate is
+// missing or not ready. Both are expected until cert-manager issues the secret.
+func IsNotIssued(err error) bool {
+	return errors.Is(err, ErrCertificateNotFound) || errors.Is(err, ErrCertificateNotReady)
+}
+
 type CertManagerClient struct {
-	client *versioned.Clientset
+	client     versioned.Interface
+	kubeClient kubernetes.Interface
+
+	certificates cmlisters.CertificateLister
+	secrets      corelisters.SecretLister
 }
 
-func NewCertManagerClient() (*CertManagerClient, error) {
-	restClient, err := k8s.PrepareInClusterK8SClient()
+// NewCertManagerClient builds the cert-manager and Kubernetes clientsets from the rest config.
+func NewCertManagerClient(restClient *rest.Config) (*CertManagerClient, error) {
+	certManagerClient, err := versioned.NewForConfig(restClient)
 	if err != nil {
 		return nil, fmt.Errorf("error creating cert-manager client: %v", err)
 	}
 
-	certManagerClient, err := versioned.NewForConfig(restClient)
+	kubeClient, err := kubernetes.NewForConfig(restClient)
 	if err != nil {
-		return nil, fmt.Errorf("error creating cert-manager client: %v", err)
+		return nil, fmt.Errorf("error creating kubernetes client: %v", err)
+	}
+	return &CertManagerClient{client: certManagerClient, kubeClient: kubeClient}, nil
+}
+
+// NewCertManagerClientFromClientset wraps already built cert-manager and Kubernetes clientsets.
+func NewCertManagerClientFromClientset(client versioned.Interface, kubeClient kubernetes.Interface) *CertManagerClient {
+	return &CertManagerClient{client: client, kubeClient: kubeClient}
+}
+
+// WithListers returns a client reading Certificates and TLS Secrets from the
+// listers of synced informers instead of the API server.
+func (cmc *CertManagerClient) WithListers(certificates cmlisters.CertificateLister, secrets corelisters.SecretLister) *CertManagerClient {
+	listed := *cmc
+	listed.certificates = certificates
+	listed.secrets = secrets
+	return &listed
+}
+
+// CheckIfSecretCertificateIsReady resolves the Certificate issuing the TLS secret
+// and reports whether it is ready. A missing or not ready Certificate is returned
+// as ErrCertificateNotFound or ErrCertificateNotReady.
+func (cmc *CertManagerClient) CheckIfSecretCertificateIsReady(ctx context.Context, secretName, namespace, ingressName string) (*certmanagerv1.Certificate, bool, error) {
+	cert, err := cmc.FindCertificateForSecret(ctx, secretName, namespace, ingressName)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if IsCertificateReady(cert) {
+		return cert, true, nil
+	}
+
+	return cert, false, fmt.Errorf("certificate %s: %w", cert.Name, ErrCertificateNotReady)
+}
+
+// FindCertificateForSecret returns the Certificate issuing the TLS secret. The
+// certificate-name annotation of the issued Secret is used first, otherwise the
+// Certificate with a matching spec.secretName, preferring the one owned by the ingress.
+func (cmc *CertManagerClient) FindCertificateForSecret(ctx context.Context, secretName, namespace, ingressName string) (*certmanagerv1.Certificate, error) {
+	if cmc.kubeClient != nil || cmc.secrets != nil {
+		secret, err := cmc.getSecret(ctx, secretName, namespace)
+		if err != nil && !apierrors.IsNotFound(err) {
+			return nil, fmt.Errorf("error getting secret: %w", err)
+		}
+		if err == nil && secret.Annotations[CertificateNameAnnotation] != "" {
+			cert, err := cmc.getCertificate(ctx, secret.Annotations[CertificateNameAnnotation], namespace)
+			if err == nil && cert.Spec.SecretName == secretName {
+				return cert, nil
+			}
+			if err != nil && !apierrors.IsNotFound(err) {
+				return nil, fmt.Errorf("error getting certificate: %w", err)
+			}
+		}
+	}
+
+	certs, err := cmc.listCertificates(ctx, namespace)
+	if err != nil {
+		return nil, fmt.Errorf("error listing certificates: %w", err)
+	}
+
+	cert := SelectCertificateForSecret(certs, secretName, ingressName)
+	if cert == nil {
+		return nil, fmt.Errorf("%w for secret %s in namespace %s", ErrCertificateNotFound, secretName, namespace)
+	}
+	if cmc.certificates != nil {
+		return cert.DeepCopy(), nil
+	}
+	return cert, nil
+}
+
+func (cmc *CertManagerClient) getSecret(ctx context.Context, name, namespace string) (*corev1.Secret, error) {
+	if cmc.secrets != nil {
+		return cmc.secrets.Secrets(namespace).Get(name)
 	}
-	return &CertManagerClient{client: certManagerClient}, nil
+	return cmc.kubeClient.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
 }
 
-func (cmc *CertManagerClient) CheckIfCertificateIsReady(certificateName string, namespace string) (bool, error) {
-	cert, err := cmc.client.CertmanagerV1().Certificates(namespace).Get(context.TODO(), certificateName, metav1.GetOptions{})
+// getCertificate returns a copy, callers may modify the Certificate.
+func (cmc *CertManagerClient) getCertificate(ctx context.Context, name, namespace string) (*certmanagerv1.Certificate, error) {
+	if cmc.certificates != nil {
+		cert, err := cmc.certificates.Certificates(namespace).Get(name)
+		if err != nil {
+			return nil, err
+		}
+		return cert.DeepCopy(), nil
+	}
+	return cmc.client.CertmanagerV1().Certificates(namespace).Get(ctx, name, metav1.GetOptions{})
+}
+
+// listCertificates returns the Certificates shared with the informer cache when
+// the listers are set.
+func (cmc *CertManagerClient) listCertificates(ctx context.Context, namespace string) ([]*certmanagerv1.Certificate, error) {
+	if cmc.certificates != nil {
+		return cmc.certificates.Certificates(namespace).List(labels.Everything())
+	}
+
+	certList, err := cmc.client.CertmanagerV1().Certificates(namespace).List(ctx, metav1.ListOptions{})
 	if err != nil {
-		return false, fmt.Errorf("error getting certificate: %v", err)
+		return nil, err
 	}
+	certs := make([]*certmanagerv1.Certificate, 0, len(certList.Items))
+	for i := range certList.Items {
+		certs = append(certs, &certList.Items[i])
+	}
+	return certs, nil
+}
 
+// SelectCertificateForSecret picks the Certificate with the given spec.secretName,
+// preferring the one owned by the ingress when several Certificates share the secret.
+func SelectCertificateForSecret(certs []*certmanagerv1.Certificate, secretName, ingressName string) *certmanagerv1.Certificate {
+	var found *certmanagerv1.Certificate
+	for _, cert := range certs {
+		if cert.Spec.SecretName != secretName {
+			continue
+		}
+		if IsOwnedByIngress(cert, ingressName) {
+			return cert
+		}
+		if found == nil {
+			found = cert
+		}
+	}
+	return found
+}
+
+// IsOwnedByIngress reports whether the certificate has an owner reference to the ingress.
+func IsOwnedByIngress(cert *certmanagerv1.Certificate, ingressName string) bool {
+	for _, ownerRef := range cert.GetOwnerReferences() {
+		if ownerRef.Kind == "Ingress" && ownerRef.Name == ingressName {
+			return true
+		}
+	}
+	return false
+}
+
+// IsCertificateReady reports whether the certificate has the Ready condition set to True.
+func IsCertificateReady(cert *certmanagerv1.Certificate) bool {
 	for _, condition := range cert.Status.Conditions {
 		if condition.Type == certmanagerv1.CertificateConditionReady && condition.Status == cmmeta.ConditionTrue {
-			return true, nil
+			return true
 		}
 	}
-
-	return false, fmt.Errorf("certificate %s is not ready", certificateName)
+	return false
 }
@@ -0,0 +1,164 @@
+package certmanagerwrapper
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	certmanagerv1 "github.com/jetstack/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/jetstack/cert-manager/pkg/apis/meta/v1"
+	cmfake "github.com/jetstack/cert-manager/pkg/client/clientset/versioned/fake"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func testCertificate(name, secretName string, ready bool) *certmanagerv1.Certificate {
+	status := cmmeta.ConditionFalse
+	if ready {
+		status = cmmeta.ConditionTrue
+	}
+	return &certmanagerv1.Certificate{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "shop"},
+		Spec:       certmanagerv1.CertificateSpec{SecretName: secretName},
+		Status: certmanagerv1.CertificateStatus{
+			Conditions: []certmanagerv1.CertificateCondition{{Type: certmanagerv1.CertificateConditionReady, Status: status}},
+		},
+	}
+}
+
+func TestCheckIfSecretCertificateIsReady(t *testing.T) {
+	errAPI := apierrors.NewServiceUnavailable("apiserver is down")
+
+	tests := []struct {
+		name          string
+		certificates  []runtime.Object
+		listErr       error
+		wantReady     bool
+		wantErr       error
+		wantNotIssued bool
+	}{
+		{
+			name:         "ready",
+			certificates: []runtime.Object{testCertificate("shop-tls", "shop-tls", true)},
+			wantReady:    true,
+		},
+		{
+			name:          "not ready",
+			certificates:  []runtime.Object{testCertificate("shop-tls", "shop-tls", false)},
+			wantErr:       ErrCertificateNotReady,
+			wantNotIssued: true,
+		},
+		{
+			name:          "no certificate",
+			certificates:  []runtime.Object{testCertificate("other-tls", "other-tls", true)},
+			wantErr:       ErrCertificateNotFound,
+			wantNotIssued: true,
+		},
+		{
+			name:    "listing fails",
+			listErr: errAPI,
+			wantErr: errAPI,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmClient := cmfake.NewSimpleClientset(tt.certificates...)
+			if tt.listErr != nil {
+				cmClient.PrependReactor("list", "certificates", func(k8stesting.Action) (bool, runtime.Object, error) {
+					return true, nil, tt.listErr
+				})
+			}
+			cmc := NewCertManagerClientFromClientset(cmClient, kubefake.NewSimpleClientset())
+
+			_, ready, err := cmc.CheckIfSecretCertificateIsReady(context.Background(), "shop-tls", "shop", "shop")
+			if ready != tt.wantReady {
+				t.Errorf("ready = %t, want %t", ready, tt.wantReady)
+			}
+			if tt.wantErr == nil && err != nil {
+				t.Errorf("error = %v, want none", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("error = %v, want %v", err, tt.wantErr)
+			}
+			if IsNotIssued(err) != tt.wantNotIssued {
+				t.Errorf("IsNotIssued(%v) = %t, want %t", err, IsNotIssued(err), tt.wantNotIssued)
+			}
+		})
+	}
+}
+
+func TestSelectCertificateForSecret(t *testing.T) {
+	owned := func(cert *certmanagerv1.Certificate, ingressName string) *certmanagerv1.Certificate {
+		cert.OwnerReferences = []metav1.OwnerReference{{Kind: "Ingress", Name: ingressName}}
+		return cert
+	}
+
+	tests := []struct {
+		name  string
+		certs []*certmanagerv1.Certificate
+		want  string
+	}{
+		{
+			name: "none",
+		},
+		{
+			name:  "other secret",
+			certs: []*certmanagerv1.Certificate{testCertificate("other", "other-tls", true)},
+		},
+		{
+			name:  "named differently than the secret",
+			certs: []*certmanagerv1.Certificate{testCertificate("shop-cert", "shop-tls", true)},
+			want:  "shop-cert",
+		},
+		{
+			name: "first of several",
+			certs: []*certmanagerv1.Certificate{
+				testCertificate("other", "other-tls", true),
+				testCertificate("first", "shop-tls", true),
+				testCertificate("second", "shop-tls", true),
+			},
+			want: "first",
+		},
+		{
+			name: "owned by the ingress wins",
+			certs: []*certmanagerv1.Certificate{
+				testCertificate("first", "shop-tls", true),
+				owned(testCertificate("owned", "shop-tls", true), "shop"),
+			},
+			want: "owned",
+		},
+		{
+			name: "owned by another ingress",
+			certs: []*certmanagerv1.Certificate{
+				owned(testCertificate("foreign", "shop-tls", true), "admin"),
+				testCertificate("second", "shop-tls", true),
+			},
+			want: "foreign",
+		},
+		{
+			name: "owned with another secret",
+			certs: []*certmanagerv1.Certificate{
+				owned(testCertificate("owned", "other-tls", true), "shop"),
+				testCertificate("shop", "shop-tls", true),
+			},
+			want: "shop",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := SelectCertificateForSecret(tt.certs, "shop-tls", "shop")
+			name := ""
+			if got != nil {
+				name = got.Name
+			}
+			if name != tt.want {
+				t.Errorf("SelectCertificateForSecret() = %q, want %q", name, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,212 @@
+package certcacheclient
+
+import (
+	"context"
+	"fmt"
+
+	"dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/apis/certcache/v1alpha1"
+	"dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/plan"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/util/retry"
+)
+
+// Client reads and writes CertificateCache resources through the dynamic client.
+type Client struct {
+	client dynamic.Interface
+	plan   *plan.Plan
+}
+
+func NewForConfig(config *rest.Config) (*Client, error) {
+	client, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("error creating dynamic client: %w", err)
+	}
+	return &Client{client: client}, nil
+}
+
+func NewForDynamic(client dynamic.Interface) *Client {
+	return &Client{client: client}
+}
+
+// WithPlan returns a client which records status updates in the plan instead of
+// writing them, reads still go to the cluster.
+func (c *Client) WithPlan(p *plan.Plan) *Client {
+	return &Client{client: c.client, plan: p}
+}
+
+// Ref identifies the CertificateCache of a TLS secret together with the objects using it.
+type Ref struct {
+	Namespace       string
+	SecretName      string
+	IngressName     string
+	IngressUID      types.UID
+	CertificateName string
+}
+
+func (c *Client) resource(namespace string) dynamic.ResourceInterface {
+	return c.client.Resource(v1alpha1.CertificateCacheResource).Namespace(namespace)
+}
+
+// Get returns the CertificateCache named after the TLS secret, nil when it does not exist.
+func (c *Client) Get(ctx context.Context, namespace, secretName string) (*v1alpha1.CertificateCache, error) {
+	obj, err := c.resource(namespace).Get(ctx, secretName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting certificate cache: %w", err)
+	}
+	return fromUnstructured(obj)
+}
+
+// List returns the CertificateCaches of a namespace, all namespaces when empty.
+func (c *Client) List(ctx context.Context, namespace string) ([]v1alpha1.CertificateCache, error) {
+	list, err := c.resource(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("error listing certificate caches: %w", err)
+	}
+
+	caches := make([]v1alpha1.CertificateCache, 0, len(list.Items))
+	for i := range list.Items {
+		cc, err := fromUnstructured(&list.Items[i])
+		if err != nil {
+			return nil, err
+		}
+		caches = append(caches, *cc)
+	}
+	return caches, nil
+}
+
+// UpdateStatus creates the CertificateCache of the ref when missing, moves it to
+// the phase and lets mutate fill the remaining status fields.
+func (c *Client) UpdateStatus(ctx context.Context, ref Ref, phase v1alpha1.CertificateCachePhase, reason, message string, mutate func(*v1alpha1.CertificateCacheStatus)) error {
+	if c.plan.Enabled() {
+		c.plan.Record("CertificateCache", plan.OperationUpdateStatus, ref.Namespace+"/"+ref.SecretName, fmt.Sprintf("phase=%s reason=%s", phase, reason))
+		return nil
+	}
+
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cc, err := c.getOrCreate(ctx, ref)
+		if err != nil {
+			return err
+		}
+
+		cc.Status.SetPhase(phase, reason, message)
+		if mutate != nil {
+			mutate(&cc.Status)
+		}
+
+		obj, err := toUnstructured(cc)
+		if err != nil {
+			return err
+		}
+		_, err = c.resource(ref.Namespace).UpdateStatus(ctx, obj, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+func (c *Client) getOrCreate(ctx context.Context, ref Ref) (*v1alpha1.CertificateCache, error) {
+	cc, err := c.Get(ctx, ref.Namespace, ref.SecretName)
+	if err != nil {
+		return nil, err
+	}
+	if cc != nil {
+		return c.updateSpec(ctx, cc, ref)
+	}
+
+	cc = &v1alpha1.CertificateCache{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: v1alpha1.SchemeGroupVersion.String(),
+			Kind:       "CertificateCache",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            ref.SecretName,
+			Namespace:       ref.Namespace,
+			OwnerReferences: ingressOwnerReferences(ref),
+		},
+		Spec: v1alpha1.CertificateCacheSpec{
+			SecretName:      ref.SecretName,
+			IngressName:     ref.IngressName,
+			CertificateName: ref.CertificateName,
+		},
+	}
+	obj, err := toUnstructured(cc)
+	if err != nil {
+		return nil, err
+	}
+	created, err := c.resource(ref.Namespace).Create(ctx, obj, metav1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		// Created concurrently, retry with the existing object
+		return nil, apierrors.NewConflict(v1alpha1.CertificateCacheResource.GroupResource(), ref.SecretName, err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error creating certificate cache: %w", err)
+	}
+	return fromUnstructured(created)
+}
+
+// updateSpec fills in references learned after the CertificateCache was created,
+// e.g. the Ingress UID which is not known yet when admitting a new Ingress.
+func (c *Client) updateSpec(ctx context.Context, cc *v1alpha1.CertificateCache, ref Ref) (*v1alpha1.CertificateCache, error) {
+	changed := false
+	if ref.IngressName != "" && cc.Spec.IngressName != ref.IngressName {
+		cc.Spec.IngressName = ref.IngressName
+		changed = true
+	}
+	if ref.CertificateName != "" && cc.Spec.CertificateName != ref.CertificateName {
+		cc.Spec.CertificateName = ref.CertificateName
+		changed = true
+	}
+	if len(cc.OwnerReferences) == 0 && ref.IngressUID != "" {
+		cc.OwnerReferences = ingressOwnerReferences(ref)
+		changed = true
+	}
+	if !changed {
+		return cc, nil
+	}
+
+	obj, err := toUnstructured(cc)
+	if err != nil {
+		return nil, err
+	}
+	updated, err := c.resource(cc.Namespace).Update(ctx, obj, metav1.UpdateOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return fromUnstructured(updated)
+}
+
+func ingressOwnerReferences(ref Ref) []metav1.OwnerReference {
+	if ref.IngressUID == "" {
+		return nil
+	}
+	return []metav1.OwnerReference{{
+		APIVersion: "networking.k8s.io/v1",
+		Kind:       "Ingress",
+		Name:       ref.IngressName,
+		UID:        ref.IngressUID,
+	}}
+}
+
+func fromUnstructured(obj *unstructured.Unstructured) (*v1alpha1.CertificateCache, error) {
+	cc := &v1alpha1.CertificateCache{}
+	err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.UnstructuredContent(), cc)
+	if err != nil {
+		return nil, fmt.Errorf("error converting certificate cache: %w", err)
+	}
+	return cc, nil
+}
+
+func toUnstructured(cc *v1alpha1.CertificateCache) (*unstructured.Unstructured, error) {
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(cc)
+	if err != nil {
+		return nil, fmt.Errorf("error converting certificate cache: %w", err)
+	}
+	return &unstructured.Unstructured{Object: content}, nil
+}
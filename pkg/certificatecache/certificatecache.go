@@ -2,238 +2,762 @@ package certificatecache
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
-	azurewrapper "dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/azure"
+	"dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/apis/certcache/v1alpha1"
 	certmanagerwrapper "dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/cert-manager-wrapper"
+	"dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/certcacheclient"
+	"dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/certstore"
+	"dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/metrics"
+	"dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/plan"
 	"dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/utils"
+	certmanagerv1 "github.com/jetstack/cert-manager/pkg/apis/certmanager/v1"
 	"github.com/jetstack/cert-manager/pkg/client/clientset/versioned"
+	cmlisters "github.com/jetstack/cert-manager/pkg/client/listers/certmanager/v1"
 	kwhlog "github.com/slok/kubewebhook/v2/pkg/log"
+	corev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	networkinglisters "k8s.io/client-go/listers/networking/v1"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/retry"
 )
 
 type CertificateCacheManager struct {
-	k8sClient         *kubernetes.Clientset
-	keyVaultClient    *azurewrapper.KeyVaultClient
-	certManagerClient *versioned.Clientset
-	logger            kwhlog.Logger
+	k8sClient   *kubernetes.Clientset
+	certStore   certstore.CertStore
+	certManager *certmanagerwrapper.CertManagerClient
+	cacheClient *certcacheclient.Client
+	policy      Policy
+	metrics     *metrics.Recorder
+	recorder    record.EventRecorder
+	plan        *plan.Plan
+	logger      kwhlog.Logger
+
+	ingresses  networkinglisters.IngressLister
+	secrets    corelisters.SecretLister
+	namespaces corelisters.NamespaceLister
 }
 
-func NewCertificateCacheManager(k8sClient *kubernetes.Clientset, keyVaultClient *azurewrapper.KeyVaultClient, certManagerClient *versioned.Clientset, logger kwhlog.Logger) *CertificateCacheManager {
+func NewCertificateCacheManager(k8sClient *kubernetes.Clientset, certStore certstore.CertStore, certManagerClient *versioned.Clientset, cacheClient *certcacheclient.Client, policy Policy, metricsRec *metrics.Recorder, recorder record.EventRecorder, p *plan.Plan, logger kwhlog.Logger) *CertificateCacheManager {
 	return &CertificateCacheManager{
-		k8sClient:         k8sClient,
-		keyVaultClient:    keyVaultClient,
-		certManagerClient: certManagerClient,
-		logger:            logger,
+		k8sClient:   k8sClient,
+		certStore:   certStore,
+		certManager: certmanagerwrapper.NewCertManagerClientFromClientset(certManagerClient, k8sClient),
+		cacheClient: cacheClient,
+		policy:      policy,
+		metrics:     metricsRec,
+		recorder:    recorder,
+		plan:        p,
+		logger:      logger,
 	}
 }
 
-func (ccm *CertificateCacheManager) CheckAndCacheCertificates() error {
-	ingressList, err := ccm.k8sClient.NetworkingV1().Ingresses("").List(context.TODO(), metav1.ListOptions{})
+// WithListers returns a manager reading Ingresses, Certificates, TLS Secrets and
+// Namespaces from the listers of synced informers instead of the API server.
+func (ccm *CertificateCacheManager) WithListers(ingresses networkinglisters.IngressLister, certificates cmlisters.CertificateLister, secrets corelisters.SecretLister, namespaces corelisters.NamespaceLister) *CertificateCacheManager {
+	listed := *ccm
+	listed.ingresses = ingresses
+	listed.secrets = secrets
+	listed.namespaces = namespaces
+	listed.certManager = ccm.certManager.WithListers(certificates, secrets)
+	return &listed
+}
+
+// ReconcileIngress migrates annotation based state, schedules the ingress TLS
+// secrets once their certificate is ready and stores them in the same pass.
+func (ccm *CertificateCacheManager) ReconcileIngress(ctx context.Context, ingress *v1.Ingress) error {
+	err := ccm.migrateIngress(ctx, ingress)
+	if err != nil {
+		return err
+	}
+	err = ccm.markIngress(ctx, ingress)
+	if err != nil {
+		return err
+	}
+	return ccm.cacheIngressCertificate(ctx, ingress)
+}
+
+func (ccm *CertificateCacheManager) CheckAndCacheCertificates(ctx context.Context) error {
+	ingresses, err := ccm.listIngresses(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to list ingress objects: %w", err)
 	}
 
-	for _, ingress := range ingressList.Items {
-		if ingress.Annotations["admissions.drmax.gl/cert-scheduled-for-save"] == "true" &&
-			ingress.Annotations["admissions.drmax.gl/cache-certs"] == "true" {
+	for _, ingress := range ingresses {
+		err = ccm.cacheIngressCertificate(ctx, ingress)
+		if certstore.IsTransient(err) {
+			// The remaining ingresses are handled by the next run
+			return fmt.Errorf("failed to cache certificates: %w", err)
+		}
+		if err != nil {
+			ccm.logger.Errorf("%v", err)
+		}
+	}
 
-			secretName := ingress.Spec.TLS[0].SecretName
-			namespace := ingress.Namespace
+	return nil
+}
 
-			certManagerClient, err := certmanagerwrapper.NewCertManagerClient()
-			if err != nil {
-				ccm.logger.Errorf("failed to create cert-manager client: %v", err)
-				continue
-			}
+// cacheIngressCertificate stores every TLS secret scheduled for save in the cache
+// and overwrites cached secrets once cert-manager renewed them.
+func (ccm *CertificateCacheManager) cacheIngressCertificate(ctx context.Context, ingress *v1.Ingress) error {
+	if !CachingEnabled(ingress) {
+		return nil
+	}
 
-			existReady, err := certManagerClient.CheckIfCertificateIsReady(secretName, namespace)
-			if err != nil {
-				//comment this error due to the fact that it is not a critical error
-				//its only spamming while some cert are not ready for longer time
-				//ccm.logger.Errorf("failed to check if certificate is ready: %v", err)
-				continue
-			}
+	var errs []error
+	for _, secretName := range TLSSecretNames(ingress) {
+		cc, err := ccm.cacheClient.Get(ctx, ingress.Namespace, secretName)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if cc == nil || (!cc.Status.WantsCaching() && cc.Status.Phase != v1alpha1.PhaseCached) {
+			continue
+		}
 
-			if existReady {
-				// Get the Kubernetes Secret
-				secret, err := ccm.k8sClient.CoreV1().Secrets(namespace).Get(context.Background(), secretName, metav1.GetOptions{})
-				if err != nil {
-					ccm.logger.Errorf("failed to get Kubernetes secret: %v", err)
-					continue
-				}
+		err = ccm.cacheSecret(ctx, ingress, secretName, cc)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
 
-				cert := secret.Data["tls.crt"]
-				key := secret.Data["tls.key"]
+	return errors.Join(errs...)
+}
 
-				//Check if the cert is in period of renewal (less then 1 month) then skip caching
-				secretCertExpire, err := utils.GetFirstCertExpiryFromPEM(cert)
-				if err != nil {
-					ccm.logger.Errorf("failed to get certificate expiry: %v", err)
-					continue
-				}
+// cacheSecret stores a single ready TLS secret in the cache and records the outcome.
+// A cached secret is only written again when its certificate was renewed, as a new
+// version of the same entry so the cache never misses a valid certificate.
+func (ccm *CertificateCacheManager) cacheSecret(ctx context.Context, ingress *v1.Ingress, secretName string, cc *v1alpha1.CertificateCache) error {
+	namespace := ingress.Namespace
 
-				if time.Now().AddDate(0, 1, 0).After(secretCertExpire) {
-					ccm.logger.Debugf("Certificate for ingress %s in namespace %s is expiring in less then one month. Skipping add to cache until new cert are issued", ingress.Name, ingress.Namespace)
-					continue
-				}
+	certificate, existReady, err := ccm.certManager.CheckIfSecretCertificateIsReady(ctx, secretName, namespace, ingress.Name)
+	if certmanagerwrapper.IsNotIssued(err) {
+		// Not logged, it only spams while some certificates are not ready for longer time
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check if certificate of secret %s is ready: %w", secretName, err)
+	}
+	if !existReady {
+		return nil
+	}
+	ref := ccm.ref(ingress, secretName, certificate)
 
-				// Store the cert and key in Azure Key Vault
-				vaultSecretName := fmt.Sprintf("%s--%s", secretName, namespace)
-				err = ccm.keyVaultClient.StoreSecret(context.Background(), vaultSecretName, cert, key)
-				if err != nil {
-					ccm.logger.Errorf("failed to store secret in key vault: %v", err)
-					continue
-				}
+	// Get the Kubernetes Secret
+	secret, err := ccm.getSecret(ctx, namespace, secretName)
+	if err != nil {
+		return fmt.Errorf("failed to get Kubernetes secret: %w", err)
+	}
 
-				err = ccm.updateIngressAnnotations(&ingress, map[string]string{
-					"admissions.drmax.gl/cert-cached":             "true",
-					"admissions.drmax.gl/cert-scheduled-for-save": "false",
-				})
-				if err != nil {
-					ccm.logger.Errorf("failed to update ingress annotations: %v", err)
-				}
+	cert := secret.Data["tls.crt"]
+	key := secret.Data["tls.key"]
 
-				ccm.logger.Infof("certificate for ingress %s in namespace %s is stored in Azure KeyVault and correctly marked using annotations", ingress.Name, ingress.Namespace)
+	secretCertExpire, err := utils.GetFirstCertExpiryFromPEM(cert)
+	if err != nil {
+		return fmt.Errorf("failed to get certificate expiry: %w", err)
+	}
+	_, altNames, err := utils.GetFirstCertDetailsFromPEM(cert)
+	if err != nil {
+		return fmt.Errorf("failed to get certificate details: %w", err)
+	}
+	serialNumber, err := utils.GetFirstCertSerialFromPEM(cert)
+	if err != nil {
+		return fmt.Errorf("failed to get certificate serial number: %w", err)
+	}
 
-			}
+	cacheKey := CacheKey(secretName, namespace)
+	reason, message := v1alpha1.ReasonStored, "Certificate is stored in cache"
+	if cc.Status.Phase == v1alpha1.PhaseCached {
+		renewed, err := ccm.isRenewed(ctx, cc, cacheKey, serialNumber, secretCertExpire)
+		if err != nil {
+			return err
+		}
+		if !renewed {
+			return nil
+		}
+		ccm.logger.Infof("certificate %s for ingress %s in namespace %s was renewed (serial %s, expires %s), updating cache", secretName, ingress.Name, ingress.Namespace, serialNumber, secretCertExpire.Format(time.RFC3339))
+		reason, message = v1alpha1.ReasonRenewed, "Renewed certificate is stored in cache"
+	} else if time.Now().Add(ccm.policyFor(ctx, ingress).MinValidity).After(secretCertExpire) {
+		//Check if the cert is in period of renewal then skip caching
+		ccm.logger.Debugf("Certificate %s for ingress %s in namespace %s is expiring in less then the minimum validity. Skipping add to cache until new cert are issued", secretName, ingress.Name, ingress.Namespace)
+		return ccm.cacheClient.UpdateStatus(ctx, ref, v1alpha1.PhaseExpiring, v1alpha1.ReasonExpiring,
+			fmt.Sprintf("Certificate expires at %s, waiting for renewal before caching", secretCertExpire.Format(time.RFC3339)), nil)
+	}
+
+	// Store the cert and key in the cache backend, overwriting an existing entry adds a new version
+	err = ccm.certStore.StoreSecret(ctx, cacheKey, cert, key)
+	if certstore.IsTransient(err) {
+		// Kept in its phase, the reconciler retries once the backend is back
+		return fmt.Errorf("failed to store secret in cache: %w", err)
+	}
+	if err != nil {
+		RecordEvent(ccm.recorder, ingress, certificate, corev1.EventTypeWarning, v1alpha1.ReasonBackendError, "Failed to store secret %s in cache: %v", secretName, err)
+		statusErr := ccm.cacheClient.UpdateStatus(ctx, ref, v1alpha1.PhaseError, v1alpha1.ReasonBackendError, err.Error(), nil)
+		if statusErr != nil {
+			ccm.logger.Errorf("failed to update certificate cache status: %v", statusErr)
 		}
+		return fmt.Errorf("failed to store secret in cache: %w", err)
+	}
+	ccm.metrics.CertificateStored(namespace, secretName, secretCertExpire)
+	RecordEvent(ccm.recorder, ingress, certificate, corev1.EventTypeNormal, reason, "%s, secret %s expires at %s", message, secretName, secretCertExpire.Format(time.RFC3339))
+
+	err = ccm.cacheClient.UpdateStatus(ctx, ref, v1alpha1.PhaseCached, reason, message,
+		func(status *v1alpha1.CertificateCacheStatus) {
+			now := metav1.Now()
+			status.LastSyncTime = &now
+			status.BackendKey = cacheKey
+			status.NotAfter = &metav1.Time{Time: secretCertExpire}
+			status.SANs = altNames
+			status.SerialNumber = serialNumber
+		})
+	if err != nil {
+		return fmt.Errorf("failed to update certificate cache status: %w", err)
 	}
 
+	ccm.logger.Infof("certificate %s for ingress %s in namespace %s is stored in cache", secretName, ingress.Name, ingress.Namespace)
 	return nil
 }
 
-func (ccm *CertificateCacheManager) CleanupExpiringCertificates() error {
-	ingressList, err := ccm.k8sClient.NetworkingV1().Ingresses("").List(context.TODO(), metav1.ListOptions{})
+// isRenewed compares the certificate of the TLS secret with the cached one. Entries
+// cached before the serial number was recorded are compared with the backend once.
+func (ccm *CertificateCacheManager) isRenewed(ctx context.Context, cc *v1alpha1.CertificateCache, cacheKey, serialNumber string, notAfter time.Time) (bool, error) {
+	if cc.Status.SerialNumber != "" {
+		return cc.Status.SerialNumber != serialNumber || cc.Status.NotAfter == nil || !cc.Status.NotAfter.Time.Equal(notAfter), nil
+	}
+
+	exists, err := ccm.certStore.SecretExists(ctx, cacheKey)
+	if err != nil {
+		return false, fmt.Errorf("failed to check secret in cache: %w", err)
+	}
+	if !exists {
+		return true, nil
+	}
+	cachedCert, _, err := ccm.certStore.GetSecret(ctx, cacheKey)
+	switch {
+	case errors.Is(err, certstore.ErrNotFound):
+		return true, nil
+	case errors.Is(err, certstore.ErrCorrupt):
+		ccm.logger.Warningf("cached certificate %s can not be read and is overwritten: %v", cacheKey, err)
+		return true, nil
+	case err != nil:
+		return false, fmt.Errorf("failed to get secret from cache: %w", err)
+	}
+	cachedSerialNumber, err := utils.GetFirstCertSerialFromPEM(cachedCert)
+	if err != nil {
+		ccm.logger.Warningf("cached certificate %s can not be read and is overwritten: %v", cacheKey, err)
+		return true, nil
+	}
+	if cachedSerialNumber != serialNumber {
+		return true, nil
+	}
+
+	// Same certificate, remember the serial number so the backend is not read again
+	reason := cc.Status.CachedReason()
+	if reason == "" {
+		reason = v1alpha1.ReasonStored
+	}
+	err = ccm.cacheClient.UpdateStatus(ctx, certcacheclient.Ref{Namespace: cc.Namespace, SecretName: cc.Name}, v1alpha1.PhaseCached, reason, "Certificate is stored in cache",
+		func(status *v1alpha1.CertificateCacheStatus) {
+			status.NotAfter = &metav1.Time{Time: notAfter}
+			status.SerialNumber = serialNumber
+		})
+	if err != nil {
+		return false, fmt.Errorf("failed to update certificate cache status: %w", err)
+	}
+	return false, nil
+}
+
+func (ccm *CertificateCacheManager) CleanupExpiringCertificates(ctx context.Context) error {
+	ingresses, err := ccm.listIngresses(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to list ingress objects: %w", err)
 	}
 
-	for _, ingress := range ingressList.Items {
-		if ingress.Annotations["admissions.drmax.gl/cert-cached"] == "true" {
-			secretName := ingress.Spec.TLS[0].SecretName
-			namespace := ingress.Namespace
+	for _, ingress := range ingresses {
+		err = ccm.cleanupIngressCertificate(ctx, ingress)
+		if certstore.IsTransient(err) {
+			// The remaining ingresses are handled by the next run
+			return fmt.Errorf("failed to clean up expiring certificates: %w", err)
+		}
+		if err != nil {
+			ccm.logger.Errorf("%v", err)
+		}
+	}
 
-			secret := fmt.Sprintf("%s--%s", secretName, namespace)
-			expiry, err := ccm.keyVaultClient.GetCertificateExpiry(context.Background(), secret)
+	return nil
+}
+
+// cleanupIngressCertificate evicts cached TLS secrets which were not renewed in time,
+// once they are within EvictBefore (30 days by default) of NotAfter.
+// Renewed certificates overwrite the cache entry, so valid entries are never removed.
+// Evicted secrets are scheduled for save again once cert-manager renews them.
+func (ccm *CertificateCacheManager) cleanupIngressCertificate(ctx context.Context, ingress *v1.Ingress) error {
+	var policy *Policy
+	var errs []error
+	for _, secretName := range TLSSecretNames(ingress) {
+		cc, err := ccm.cacheClient.Get(ctx, ingress.Namespace, secretName)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if cc == nil || cc.Status.Phase != v1alpha1.PhaseCached {
+			continue
+		}
+
+		namespace := ingress.Namespace
+		secret := CacheKey(secretName, namespace)
+		expiry, err := ccm.certStore.GetCertificateExpiry(ctx, secret)
+		switch {
+		case errors.Is(err, certstore.ErrNotFound):
+			// Removed from the backend outside of the manager, it is scheduled for save again
+			ccm.logger.Warningf("certificate %s for ingress %s in namespace %s is missing from cache", secretName, ingress.Name, namespace)
+			RecordEvent(ccm.recorder, ingress, nil, corev1.EventTypeWarning, v1alpha1.ReasonMissingFromCache, "Secret %s is missing from cache and is stored again", secretName)
+			err = ccm.cacheClient.UpdateStatus(ctx, ccm.ref(ingress, secretName, nil), v1alpha1.PhaseEvicted, v1alpha1.ReasonMissingFromCache, "Certificate is missing from cache", nil)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to update certificate cache status: %w", err))
+			}
+			continue
+		case errors.Is(err, certstore.ErrCorrupt):
+			ccm.logger.Warningf("certificate %s for ingress %s in namespace %s can not be read from cache: %v", secretName, ingress.Name, namespace, err)
+			err = ccm.evict(ctx, ingress, secretName, v1alpha1.ReasonCorrupt,
+				fmt.Sprintf("Secret %s can not be read from cache and is evicted: %v", secretName, err),
+				"Cached certificate can not be read and is removed from cache")
 			if err != nil {
-				ccm.logger.Errorf("failed to get certificate expiry from key vault: %v", err)
-				continue
+				errs = append(errs, err)
 			}
+			continue
+		case certstore.IsTransient(err):
+			// Retried by the next run, an event per entry would flood the namespaces during an outage
+			errs = append(errs, fmt.Errorf("failed to get certificate expiry from cache: %w", err))
+			continue
+		case err != nil:
+			RecordEvent(ccm.recorder, ingress, nil, corev1.EventTypeWarning, v1alpha1.ReasonBackendError, "Failed to get expiry of secret %s from cache: %v", secretName, err)
+			errs = append(errs, fmt.Errorf("failed to get certificate expiry from cache: %w", err))
+			continue
+		}
 
-			if time.Now().AddDate(0, 1, 0).After(expiry) {
-				ccm.logger.Debugf("certificate for ingress %s is expiring in less then one month", ingress.Name)
-				err = ccm.keyVaultClient.DeleteSecret(context.Background(), secret)
-				if err != nil {
-					ccm.logger.Errorf("failed to delete secret from key vault: %v", err)
-					continue
-				}
+		if policy == nil {
+			resolved := ccm.policyFor(ctx, ingress)
+			policy = &resolved
+		}
+		if !time.Now().Add(policy.EvictBefore).After(expiry) {
+			ccm.logger.Debugf("certificate %s for ingress %s in namespace %s is not expiring (Time of expire %s, Time of cache removal %s)", secretName, ingress.Name, ingress.Namespace, expiry.String(), expiry.Add(-policy.EvictBefore).String())
+			continue
+		}
 
-				err = ccm.updateIngressAnnotations(&ingress, map[string]string{
-					"admissions.drmax.gl/cert-cached":             "false",
-					"admissions.drmax.gl/cert-scheduled-for-save": "true",
-				})
-				if err != nil {
-					ccm.logger.Errorf("failed to update ingress annotations: %v", err)
-				}
+		ccm.logger.Debugf("certificate %s for ingress %s was not renewed in time", secretName, ingress.Name)
+		err = ccm.evict(ctx, ingress, secretName, v1alpha1.ReasonEvicted,
+			fmt.Sprintf("Secret %s expires at %s without being renewed and is evicted from cache", secretName, expiry.Format(time.RFC3339)),
+			fmt.Sprintf("Certificate expires at %s without being renewed and is removed from cache", expiry.Format(time.RFC3339)))
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
 
-				err = ccm.updateCertificateAnnotations(secretName, namespace, map[string]string{
-					"admissions.drmax.gl/cert-cached": "false",
-				})
-				if err != nil {
-					ccm.logger.Errorf("failed to update certificate annotations: %v", err)
-				}
+		ccm.logger.Infof("certificate %s for ingress %s in namespace %s is expiring and deleted from cache", secretName, ingress.Name, ingress.Namespace)
+	}
 
-				ccm.logger.Infof("certificate for ingress %s in namespace %s is expired and deleted from Azure KeyVault", ingress.Name, ingress.Namespace)
-			}
+	return errors.Join(errs...)
+}
 
-			ccm.logger.Debugf("certificate for ingress %s in namespace %s is not expiring in less then one month (Time of expire %s, Time of cache removal %s)", ingress.Name, ingress.Namespace, expiry.String(), expiry.AddDate(0, -1, 0).String())
+// evict deletes the cache entry of a TLS secret and marks it Evicted, it is
+// scheduled for save again once its certificate is ready.
+func (ccm *CertificateCacheManager) evict(ctx context.Context, ingress *v1.Ingress, secretName, reason, eventMessage, statusMessage string) error {
+	certificate, _ := ccm.certManager.FindCertificateForSecret(ctx, secretName, ingress.Namespace, ingress.Name)
+	err := ccm.certStore.DeleteSecret(ctx, CacheKey(secretName, ingress.Namespace))
+	if err != nil {
+		if !certstore.IsTransient(err) {
+			RecordEvent(ccm.recorder, ingress, certificate, corev1.EventTypeWarning, v1alpha1.ReasonBackendError, "Failed to evict secret %s from cache: %v", secretName, err)
 		}
+		return fmt.Errorf("failed to delete secret from cache: %w", err)
 	}
+	ccm.metrics.CertificateEvicted(ingress.Namespace, secretName)
+	RecordEvent(ccm.recorder, ingress, certificate, corev1.EventTypeWarning, reason, "%s", eventMessage)
 
+	err = ccm.cacheClient.UpdateStatus(ctx, ccm.ref(ingress, secretName, nil), v1alpha1.PhaseEvicted, reason, statusMessage, nil)
+	if err != nil {
+		ccm.logger.Errorf("failed to update certificate cache status: %v", err)
+	}
 	return nil
 }
 
-func (ccm *CertificateCacheManager) CheckAndMark() error {
-	ingressList, err := ccm.k8sClient.NetworkingV1().Ingresses("").List(context.TODO(), metav1.ListOptions{})
+func (ccm *CertificateCacheManager) CheckAndMark(ctx context.Context) error {
+	ingresses, err := ccm.listIngresses(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to list ingress objects: %w", err)
 	}
 
-	for _, ingress := range ingressList.Items {
-		if ingress.Annotations["admissions.drmax.gl/cache-certs"] == "true" &&
-			ingress.Annotations["admissions.drmax.gl/cert-scheduled-for-save"] != "true" &&
-			ingress.Annotations["admissions.drmax.gl/cert-cached"] != "true" {
+	for _, ingress := range ingresses {
+		err = ccm.migrateIngress(ctx, ingress)
+		if err != nil {
+			ccm.logger.Errorf("%v", err)
+			continue
+		}
+		err = ccm.markIngress(ctx, ingress)
+		if err != nil {
+			ccm.logger.Errorf("%v", err)
+		}
+	}
+	return nil
+}
 
-			ccm.logger.Infof("Ingress %s has cache-certs annotation. checking if certificate is issued!", ingress.Name)
-			certManagerClient, err := certmanagerwrapper.NewCertManagerClient()
-			if err != nil {
-				ccm.logger.Errorf("failed to create cert-manager client: %v", err)
-				continue
-			}
-			existReady, err := certManagerClient.CheckIfCertificateIsReady(ingress.Spec.TLS[0].SecretName, ingress.Namespace)
-			if err != nil {
-				ccm.logger.Errorf("Error checking if certificate is ready: %v", err)
-			}
-			if existReady && ingress.Annotations["admissions.drmax.gl/cert-cached"] != "true" {
-				ccm.logger.Infof("Certificate for ingress %s is ready. Marking this ingress and certificate for save to cache", ingress.Name)
-				err = ccm.updateIngressAnnotations(&ingress, map[string]string{
-					"admissions.drmax.gl/cert-scheduled-for-save": "true",
-				})
+// markIngress schedules every ready TLS secret which is not tracked yet or was evicted.
+func (ccm *CertificateCacheManager) markIngress(ctx context.Context, ingress *v1.Ingress) error {
+	if !CachingEnabled(ingress) {
+		return nil
+	}
+
+	secretNames := TLSSecretNames(ingress)
+	if len(secretNames) == 0 {
+		ccm.logger.Warningf("Ingress %s in namespace %s has cache-certs annotation but no TLS secret, nothing to cache", ingress.Name, ingress.Namespace)
+		return nil
+	}
+
+	var errs []error
+	for _, secretName := range secretNames {
+		cc, err := ccm.cacheClient.Get(ctx, ingress.Namespace, secretName)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if cc != nil && cc.Status.Phase != v1alpha1.PhasePending && cc.Status.Phase != v1alpha1.PhaseEvicted {
+			continue
+		}
+
+		ccm.logger.Infof("Ingress %s has cache-certs annotation. checking if certificate %s is issued!", ingress.Name, secretName)
+		certificate, existReady, err := ccm.certManager.CheckIfSecretCertificateIsReady(ctx, secretName, ingress.Namespace, ingress.Name)
+		if err != nil && !certmanagerwrapper.IsNotIssued(err) {
+			ccm.logger.Errorf("Error checking if certificate %s is ready: %v", secretName, err)
+			errs = append(errs, fmt.Errorf("failed to check if certificate of secret %s is ready: %w", secretName, err))
+			continue
+		}
+		ref := ccm.ref(ingress, secretName, certificate)
+		if !existReady {
+			ccm.logger.Debugf("Certificate %s for ingress %s in namespace %s is not ready or already loaded from cache!", secretName, ingress.Name, ingress.Namespace)
+			if cc == nil {
+				RecordEvent(ccm.recorder, ingress, certificate, corev1.EventTypeNormal, v1alpha1.ReasonCertificateNotReady, "Certificate for secret %s is not ready, waiting before caching", secretName)
+				err = ccm.cacheClient.UpdateStatus(ctx, ref, v1alpha1.PhasePending, v1alpha1.ReasonCertificateNotReady, "Waiting for the certificate to become ready", nil)
 				if err != nil {
-					ccm.logger.Errorf("failed to update ingress annotations: %v", err)
+					errs = append(errs, fmt.Errorf("failed to update certificate cache status: %w", err))
 				}
-				ccm.logger.Infof(" -- MUTATED -- Ingress %s in namespace %s is marked for saving certificate to cache in next periodical iteration!", ingress.Name, ingress.Namespace)
-			} else {
-				ccm.logger.Debugf("Certificate for ingress %s in namespace %s is not ready or already loaded from cache!", ingress.Name, ingress.Namespace)
 			}
+			continue
 		}
+
+		ccm.logger.Infof("Certificate %s for ingress %s is ready. Marking this certificate for save to cache", secretName, ingress.Name)
+		err = ccm.cacheClient.UpdateStatus(ctx, ref, v1alpha1.PhaseScheduled, v1alpha1.ReasonScheduled, "Certificate is ready and scheduled for save to cache", nil)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to update certificate cache status: %w", err))
+			continue
+		}
+		RecordEvent(ccm.recorder, ingress, certificate, corev1.EventTypeNormal, v1alpha1.ReasonScheduled, "Secret %s is scheduled for save to cache", secretName)
+		ccm.logger.Infof(" -- MARKED -- Certificate %s of ingress %s in namespace %s is scheduled for saving to cache!", secretName, ingress.Name, ingress.Namespace)
+	}
+	return errors.Join(errs...)
+}
+
+// migrateIngress moves the annotation based cache state of the ingress to
+// CertificateCache resources and removes the annotations.
+func (ccm *CertificateCacheManager) migrateIngress(ctx context.Context, ingress *v1.Ingress) error {
+	if !hasLegacyState(ingress) {
+		return nil
 	}
+
+	for secretName, phase := range legacyPhases(ingress) {
+		cc, err := ccm.cacheClient.Get(ctx, ingress.Namespace, secretName)
+		if err != nil {
+			return err
+		}
+		if cc != nil {
+			continue
+		}
+
+		err = ccm.cacheClient.UpdateStatus(ctx, ccm.ref(ingress, secretName, nil), phase, v1alpha1.ReasonMigrated, "Cache state migrated from ingress annotations",
+			func(status *v1alpha1.CertificateCacheStatus) {
+				if phase == v1alpha1.PhaseCached {
+					status.BackendKey = CacheKey(secretName, ingress.Namespace)
+				}
+			})
+		if err != nil {
+			return fmt.Errorf("failed to migrate cache state of ingress %s: %w", ingress.Name, err)
+		}
+	}
+
+	err := ccm.removeIngressAnnotations(ctx, ingress, legacyStateAnnotations...)
+	if err != nil {
+		return fmt.Errorf("failed to remove migrated ingress annotations: %w", err)
+	}
+	ccm.logger.Infof("Cache state of ingress %s in namespace %s is migrated to CertificateCache resources", ingress.Name, ingress.Namespace)
 	return nil
 }
 
-func (ccm *CertificateCacheManager) PurgeDeletedSecrets() error {
-	secretsPendingPurge, err := ccm.keyVaultClient.ListSecretsPendingPurge(context.Background())
+func (ccm *CertificateCacheManager) PurgeDeletedSecrets(ctx context.Context) error {
+	secretsPendingPurge, err := ccm.certStore.ListSecretsPendingPurge(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to list secrets pending purge: %v", err)
 	}
 
 	for _, secret := range secretsPendingPurge {
-		err = ccm.keyVaultClient.PurgerDeletedSecret(context.Background(), secret)
+		err = ccm.certStore.PurgerDeletedSecret(ctx, secret)
+		if errors.Is(err, certstore.ErrNotFound) {
+			// Already purged
+			continue
+		}
+		if certstore.IsTransient(err) {
+			return fmt.Errorf("failed to purge secret from cache: %w", err)
+		}
 		if err != nil {
-			ccm.logger.Errorf("failed to purge secret from key vault: %v", err)
+			ccm.logger.Errorf("failed to purge secret from cache: %v", err)
 			continue
 		}
-		ccm.logger.Infof("secret %s is purged from key vault", secret)
+		ccm.metrics.CertificatePurged()
+		ccm.logger.Infof("secret %s is purged from cache", secret)
 	}
 
 	return nil
 }
 
-func (ccm *CertificateCacheManager) updateIngressAnnotations(ingress *v1.Ingress, annotations map[string]string) error {
-	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
-		for key, value := range annotations {
-			ingress.Annotations[key] = value
+// EvictSecret removes a TLS secret from the cache on request. The entry is scheduled
+// for save again once its certificate is ready, which replaces a broken entry.
+func (ccm *CertificateCacheManager) EvictSecret(ctx context.Context, namespace, secretName string) error {
+	cc, err := ccm.cacheClient.Get(ctx, namespace, secretName)
+	if err != nil {
+		return err
+	}
+	if cc == nil {
+		return apierrors.NewNotFound(v1alpha1.CertificateCacheResource.GroupResource(), secretName)
+	}
+
+	err = ccm.certStore.DeleteSecret(ctx, CacheKey(secretName, namespace))
+	if err != nil {
+		return fmt.Errorf("failed to delete secret from cache: %w", err)
+	}
+	ccm.metrics.CertificateEvicted(namespace, secretName)
+
+	err = ccm.cacheClient.UpdateStatus(ctx, certcacheclient.Ref{Namespace: namespace, SecretName: secretName}, v1alpha1.PhaseEvicted, v1alpha1.ReasonEvictedByAdmin, "Evicted from cache through the admin API", nil)
+	if err != nil {
+		return fmt.Errorf("failed to update certificate cache status: %w", err)
+	}
+
+	var ingress *v1.Ingress
+	if cc.Spec.IngressName != "" {
+		found, err := ccm.getIngress(ctx, namespace, cc.Spec.IngressName)
+		if err == nil {
+			ingress = found
 		}
-		_, err := ccm.k8sClient.NetworkingV1().Ingresses(ingress.Namespace).Update(context.TODO(), ingress, metav1.UpdateOptions{})
+	}
+	RecordEvent(ccm.recorder, ingress, nil, corev1.EventTypeWarning, v1alpha1.ReasonEvictedByAdmin, "Secret %s is evicted from cache through the admin API", secretName)
+	ccm.logger.Infof("secret %s in namespace %s is evicted from cache through the admin API", secretName, namespace)
+	return nil
+}
+
+// RecacheIngress stores the ready TLS secrets of the ingress again, regardless of
+// their current phase.
+func (ccm *CertificateCacheManager) RecacheIngress(ctx context.Context, namespace, name string) error {
+	ingress, err := ccm.getIngress(ctx, namespace, name)
+	if err != nil {
 		return err
-	})
+	}
+	if !CachingEnabled(ingress) {
+		return fmt.Errorf("ingress %s in namespace %s does not have the %s annotation", name, namespace, CacheCertsAnnotation)
+	}
+
+	var errs []error
+	for _, secretName := range TLSSecretNames(ingress) {
+		certificate, _, err := ccm.certManager.CheckIfSecretCertificateIsReady(ctx, secretName, namespace, name)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to check if certificate of secret %s is ready: %w", secretName, err))
+			continue
+		}
+		err = ccm.cacheClient.UpdateStatus(ctx, ccm.ref(ingress, secretName, certificate), v1alpha1.PhaseScheduled, v1alpha1.ReasonScheduled, "Re-cache requested through the admin API", nil)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to update certificate cache status: %w", err))
+		}
+	}
+
+	err = ccm.cacheIngressCertificate(ctx, ingress)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
 }
 
-func (ccm *CertificateCacheManager) updateCertificateAnnotations(certName, namespace string, annotations map[string]string) error {
-	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
-		cert, err := ccm.certManagerClient.CertmanagerV1().Certificates(namespace).Get(context.TODO(), certName, metav1.GetOptions{})
+// RestoreIngress writes the cached TLS secrets of the ingress to the cluster on request.
+func (ccm *CertificateCacheManager) RestoreIngress(ctx context.Context, namespace, name string) error {
+	ingress, err := ccm.getIngress(ctx, namespace, name)
+	if err != nil {
+		return err
+	}
+	policy := ccm.policyFor(ctx, ingress)
+
+	var errs []error
+	for _, secretName := range TLSSecretNames(ingress) {
+		cacheKey := CacheKey(secretName, namespace)
+		expiry, err := ccm.certStore.GetCertificateExpiry(ctx, cacheKey)
 		if err != nil {
-			return err
+			errs = append(errs, fmt.Errorf("failed to get certificate expiry of secret %s from cache: %w", secretName, err))
+			continue
 		}
-		for key, value := range annotations {
-			cert.Annotations[key] = value
+		if time.Until(expiry) < policy.RestoreMinValidity {
+			errs = append(errs, fmt.Errorf("cached certificate of secret %s expires at %s, less than the minimum validity %s to restore", secretName, expiry.Format(time.RFC3339), policy.RestoreMinValidity))
+			continue
 		}
-		_, err = ccm.certManagerClient.CertmanagerV1().Certificates(namespace).Update(context.TODO(), cert, metav1.UpdateOptions{})
+
+		// The restored Secret names its Certificate, so the name is never guessed
+		certificate, err := ccm.certManager.FindCertificateForSecret(ctx, secretName, namespace, name)
+		if errors.Is(err, certmanagerwrapper.ErrCertificateNotFound) {
+			ccm.logger.Warningf("No Certificate issues secret %s of ingress %s in namespace %s, skipping restore", secretName, name, namespace)
+			continue
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to find the certificate of secret %s: %w", secretName, err))
+			continue
+		}
+
+		if ccm.plan.Enabled() {
+			ccm.plan.Record("CertificateCacheManager", plan.OperationCreateSecret, namespace+"/"+secretName, "restore from cache key "+cacheKey)
+			continue
+		}
+		err = certstore.SaveSecretToK8s(ctx, ccm.certStore, ccm.k8sClient, cacheKey, secretName, certificate.Name, namespace)
+		if err != nil {
+			RecordEvent(ccm.recorder, ingress, certificate, corev1.EventTypeWarning, v1alpha1.ReasonBackendError, "Failed to restore secret %s from cache: %v", secretName, err)
+			errs = append(errs, fmt.Errorf("failed to restore secret %s: %w", secretName, err))
+			continue
+		}
+
+		err = ccm.cacheClient.UpdateStatus(ctx, ccm.ref(ingress, secretName, certificate), v1alpha1.PhaseCached, v1alpha1.ReasonRestored, "Certificate is restored from cache",
+			func(status *v1alpha1.CertificateCacheStatus) {
+				now := metav1.Now()
+				status.LastSyncTime = &now
+				status.BackendKey = cacheKey
+				status.NotAfter = &metav1.Time{Time: expiry}
+			})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to update certificate cache status: %w", err))
+		}
+		RecordEvent(ccm.recorder, ingress, certificate, corev1.EventTypeNormal, v1alpha1.ReasonRestored, "Secret %s is restored from cache, certificate expires at %s", secretName, expiry.Format(time.RFC3339))
+		ccm.logger.Infof("secret %s of ingress %s in namespace %s is restored from cache", secretName, name, namespace)
+	}
+	return errors.Join(errs...)
+}
+
+// RecordCacheState updates the entry metrics from the CertificateCache resources.
+func (ccm *CertificateCacheManager) RecordCacheState(ctx context.Context) error {
+	caches, err := ccm.cacheClient.List(ctx, "")
+	if err != nil {
 		return err
+	}
+
+	phases := make(map[string]int)
+	var cached []metrics.CachedEntry
+	for _, cc := range caches {
+		phases[string(cc.Status.Phase)]++
+		if cc.Status.Phase == v1alpha1.PhaseCached && cc.Status.NotAfter != nil {
+			cached = append(cached, metrics.CachedEntry{Namespace: cc.Namespace, SecretName: cc.Name, NotAfter: cc.Status.NotAfter.Time})
+		}
+	}
+	ccm.metrics.SetEntries(phases, cached)
+	return nil
+}
+
+// listIngresses returns the Ingresses of every namespace. Objects from the lister
+// are copied, the cache jobs update the Ingresses they migrate.
+func (ccm *CertificateCacheManager) listIngresses(ctx context.Context) ([]*v1.Ingress, error) {
+	if ccm.ingresses != nil {
+		listed, err := ccm.ingresses.List(labels.Everything())
+		if err != nil {
+			return nil, err
+		}
+		ingresses := make([]*v1.Ingress, 0, len(listed))
+		for _, ingress := range listed {
+			ingresses = append(ingresses, ingress.DeepCopy())
+		}
+		return ingresses, nil
+	}
+
+	ingressList, err := ccm.k8sClient.NetworkingV1().Ingresses("").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	ingresses := make([]*v1.Ingress, 0, len(ingressList.Items))
+	for i := range ingressList.Items {
+		ingresses = append(ingresses, &ingressList.Items[i])
+	}
+	return ingresses, nil
+}
+
+func (ccm *CertificateCacheManager) getIngress(ctx context.Context, namespace, name string) (*v1.Ingress, error) {
+	if ccm.ingresses != nil {
+		ingress, err := ccm.ingresses.Ingresses(namespace).Get(name)
+		if err != nil {
+			return nil, err
+		}
+		return ingress.DeepCopy(), nil
+	}
+	return ccm.k8sClient.NetworkingV1().Ingresses(namespace).Get(ctx, name, metav1.GetOptions{})
+}
+
+// getSecret returns the TLS secret, shared with the informer cache when the
+// listers are set.
+func (ccm *CertificateCacheManager) getSecret(ctx context.Context, namespace, name string) (*corev1.Secret, error) {
+	if ccm.secrets != nil {
+		return ccm.secrets.Secrets(namespace).Get(name)
+	}
+	return ccm.k8sClient.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+}
+
+// policyFor returns the cache policy with the Namespace and Ingress overrides applied.
+func (ccm *CertificateCacheManager) policyFor(ctx context.Context, ingress *v1.Ingress) Policy {
+	policy, err := ResolvePolicy(ctx, ccm.k8sClient, ccm.namespaces, ccm.policy, ingress)
+	if err != nil {
+		ccm.logger.Warningf("failed to resolve cache policy: %v", err)
+	}
+	return policy
+}
+
+func (ccm *CertificateCacheManager) ref(ingress *v1.Ingress, secretName string, certificate *certmanagerv1.Certificate) certcacheclient.Ref {
+	ref := certcacheclient.Ref{
+		Namespace:   ingress.Namespace,
+		SecretName:  secretName,
+		IngressName: ingress.Name,
+		IngressUID:  ingress.UID,
+	}
+	if certificate != nil {
+		ref.CertificateName = certificate.Name
+	}
+	return ref
+}
+
+// removeIngressAnnotations updates the ingress in place so later updates within
+// the same reconcile start from the latest resource version.
+func (ccm *CertificateCacheManager) removeIngressAnnotations(ctx context.Context, ingress *v1.Ingress, annotations ...string) error {
+	if ccm.plan.Enabled() {
+		ccm.plan.Record("CertificateCacheManager", plan.OperationUpdate, "ingress "+ingress.Namespace+"/"+ingress.Name, fmt.Sprintf("remove annotations %v", annotations))
+		return nil
+	}
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		for _, key := range annotations {
+			delete(ingress.Annotations, key)
+		}
+		updated, err := ccm.k8sClient.NetworkingV1().Ingresses(ingress.Namespace).Update(ctx, ingress, metav1.UpdateOptions{})
+		if apierrors.IsConflict(err) {
+			latest, getErr := ccm.k8sClient.NetworkingV1().Ingresses(ingress.Namespace).Get(ctx, ingress.Name, metav1.GetOptions{})
+			if getErr == nil {
+				*ingress = *latest
+			}
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		*ingress = *updated
+		return nil
 	})
 }
@@ -0,0 +1,22 @@
+package certificatecache
+
+import (
+	certmanagerv1 "github.com/jetstack/cert-manager/pkg/apis/certmanager/v1"
+	v1 "k8s.io/api/networking/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+// RecordEvent posts the event on the ingress and, when known, on the Certificate
+// issuing the TLS secret. Reasons are the CertificateCache condition reasons, so
+// events and status can be filtered the same way.
+func RecordEvent(recorder record.EventRecorder, ingress *v1.Ingress, certificate *certmanagerv1.Certificate, eventtype, reason, messageFmt string, args ...interface{}) {
+	if recorder == nil {
+		return
+	}
+	if ingress != nil {
+		recorder.Eventf(ingress, eventtype, reason, messageFmt, args...)
+	}
+	if certificate != nil {
+		recorder.Eventf(certificate, eventtype, reason, messageFmt, args...)
+	}
+}
@@ -0,0 +1,148 @@
+package certificatecache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// Namespace and Ingress annotations overriding the cluster wide Policy, the
+// values are Go durations like "720h". Ingress annotations take precedence.
+const (
+	MinValidityAnnotation        = "admissions.drmax.gl/cache-min-validity"
+	EvictBeforeAnnotation        = "admissions.drmax.gl/cache-evict-before"
+	RenewBeforeAnnotation        = "admissions.drmax.gl/cache-renew-before"
+	RestoreMinValidityAnnotation = "admissions.drmax.gl/cache-restore-min-validity"
+)
+
+// Policy holds the timing thresholds of the certificate cache.
+type Policy struct {
+	// MinValidity a certificate needs left to be stored in the cache.
+	MinValidity time.Duration
+	// EvictBefore is how long before expiry a certificate which was not renewed is evicted.
+	EvictBefore time.Duration
+	// RenewBefore is how long before expiry a restored certificate is renewed by cert-manager.
+	RenewBefore time.Duration
+	// RestoreMinValidity a cached certificate needs left to be restored.
+	RestoreMinValidity time.Duration
+}
+
+// policyFile is the on disk representation of a Policy.
+type policyFile struct {
+	MinValidity        *metav1.Duration `json:"minValidity,omitempty"`
+	EvictBefore        *metav1.Duration `json:"evictBefore,omitempty"`
+	RenewBefore        *metav1.Duration `json:"renewBefore,omitempty"`
+	RestoreMinValidity *metav1.Duration `json:"restoreMinValidity,omitempty"`
+}
+
+func DefaultPolicy() Policy {
+	return Policy{
+		MinValidity:        30 * 24 * time.Hour,
+		EvictBefore:        30 * 24 * time.Hour,
+		RenewBefore:        14 * 24 * time.Hour,
+		RestoreMinValidity: 24 * time.Hour,
+	}
+}
+
+// LoadPolicyFile reads a YAML policy file, thresholds missing in the file are taken from base.
+func LoadPolicyFile(path string, base Policy) (Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return base, fmt.Errorf("failed to read cache policy file: %w", err)
+	}
+
+	var file policyFile
+	err = yaml.UnmarshalStrict(data, &file)
+	if err != nil {
+		return base, fmt.Errorf("failed to parse cache policy file: %w", err)
+	}
+
+	policy := base
+	if file.MinValidity != nil {
+		policy.MinValidity = file.MinValidity.Duration
+	}
+	if file.EvictBefore != nil {
+		policy.EvictBefore = file.EvictBefore.Duration
+	}
+	if file.RenewBefore != nil {
+		policy.RenewBefore = file.RenewBefore.Duration
+	}
+	if file.RestoreMinValidity != nil {
+		policy.RestoreMinValidity = file.RestoreMinValidity.Duration
+	}
+	return policy, policy.Validate()
+}
+
+func (p Policy) Validate() error {
+	if p.MinValidity < 0 || p.EvictBefore < 0 || p.RenewBefore < 0 || p.RestoreMinValidity < 0 {
+		return fmt.Errorf("cache policy thresholds must not be negative")
+	}
+	return nil
+}
+
+// WithAnnotations returns the policy overridden by the annotations. Invalid values
+// are ignored and reported in the returned error.
+func (p Policy) WithAnnotations(annotations map[string]string) (Policy, error) {
+	var errs []error
+	for annotation, threshold := range map[string]*time.Duration{
+		MinValidityAnnotation:        &p.MinValidity,
+		EvictBeforeAnnotation:        &p.EvictBefore,
+		RenewBeforeAnnotation:        &p.RenewBefore,
+		RestoreMinValidityAnnotation: &p.RestoreMinValidity,
+	} {
+		value, ok := annotations[annotation]
+		if !ok {
+			continue
+		}
+		duration, err := time.ParseDuration(value)
+		if err != nil || duration < 0 {
+			errs = append(errs, fmt.Errorf("invalid %s annotation %q", annotation, value))
+			continue
+		}
+		*threshold = duration
+	}
+	return p, errors.Join(errs...)
+}
+
+// ResolvePolicy applies the Namespace and then the Ingress overrides to the base policy.
+// The Namespace is read from the lister of a synced informer when it is set,
+// otherwise from the API server. The returned policy is usable even when an
+// error is reported.
+func ResolvePolicy(ctx context.Context, client kubernetes.Interface, namespaces corelisters.NamespaceLister, base Policy, ingress *v1.Ingress) (Policy, error) {
+	var errs []error
+	policy := base
+
+	namespace, err := getNamespace(ctx, client, namespaces, ingress.Namespace)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("failed to get namespace %s: %w", ingress.Namespace, err))
+	} else {
+		policy, err = policy.WithAnnotations(namespace.Annotations)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("namespace %s: %w", ingress.Namespace, err))
+		}
+	}
+
+	policy, err = policy.WithAnnotations(ingress.Annotations)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("ingress %s/%s: %w", ingress.Namespace, ingress.Name, err))
+	}
+	return policy, errors.Join(errs...)
+}
+
+// getNamespace returns the Namespace, shared with the informer cache when the
+// lister is set.
+func getNamespace(ctx context.Context, client kubernetes.Interface, namespaces corelisters.NamespaceLister, name string) (*corev1.Namespace, error) {
+	if namespaces != nil {
+		return namespaces.Get(name)
+	}
+	return client.CoreV1().Namespaces().Get(ctx, name, metav1.GetOptions{})
+}
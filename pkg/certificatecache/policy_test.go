@@ -0,0 +1,115 @@
+package certificatecache
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestLoadPolicyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	err := os.WriteFile(path, []byte("minValidity: 240h\nevictBefore: 48h\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := LoadPolicyFile(path, DefaultPolicy())
+	if err != nil {
+		t.Fatalf("LoadPolicyFile() error = %v", err)
+	}
+	want := DefaultPolicy()
+	want.MinValidity = 240 * time.Hour
+	want.EvictBefore = 48 * time.Hour
+	if got != want {
+		t.Errorf("LoadPolicyFile() = %+v, want %+v", got, want)
+	}
+}
+
+func TestResolvePolicy(t *testing.T) {
+	base := Policy{
+		MinValidity:        240 * time.Hour,
+		EvictBefore:        48 * time.Hour,
+		RenewBefore:        336 * time.Hour,
+		RestoreMinValidity: 24 * time.Hour,
+	}
+
+	tests := []struct {
+		name             string
+		namespace        map[string]string
+		ingress          map[string]string
+		missingNamespace bool
+		want             Policy
+		wantErr          bool
+	}{
+		{
+			name: "base without annotations",
+			want: base,
+		},
+		{
+			name:      "namespace overrides base",
+			namespace: map[string]string{MinValidityAnnotation: "100h", EvictBeforeAnnotation: "10h"},
+			want:      Policy{MinValidity: 100 * time.Hour, EvictBefore: 10 * time.Hour, RenewBefore: base.RenewBefore, RestoreMinValidity: base.RestoreMinValidity},
+		},
+		{
+			name:      "ingress overrides namespace",
+			namespace: map[string]string{MinValidityAnnotation: "100h", EvictBeforeAnnotation: "10h"},
+			ingress:   map[string]string{MinValidityAnnotation: "50h", RestoreMinValidityAnnotation: "1h"},
+			want:      Policy{MinValidity: 50 * time.Hour, EvictBefore: 10 * time.Hour, RenewBefore: base.RenewBefore, RestoreMinValidity: time.Hour},
+		},
+		{
+			name:      "invalid annotations are ignored",
+			namespace: map[string]string{MinValidityAnnotation: "soon"},
+			ingress:   map[string]string{EvictBeforeAnnotation: "-1h", RenewBeforeAnnotation: "100h"},
+			want:      Policy{MinValidity: base.MinValidity, EvictBefore: base.EvictBefore, RenewBefore: 100 * time.Hour, RestoreMinValidity: base.RestoreMinValidity},
+			wantErr:   true,
+		},
+		{
+			name:             "missing namespace keeps the ingress overrides",
+			missingNamespace: true,
+			ingress:          map[string]string{RenewBeforeAnnotation: "100h"},
+			want:             Policy{MinValidity: base.MinValidity, EvictBefore: base.EvictBefore, RenewBefore: 100 * time.Hour, RestoreMinValidity: base.RestoreMinValidity},
+			wantErr:          true,
+		},
+	}
+
+	for _, tt := range tests {
+		namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "shop", Annotations: tt.namespace}}
+		ingress := &v1.Ingress{ObjectMeta: metav1.ObjectMeta{Name: "shop", Namespace: "shop", Annotations: tt.ingress}}
+
+		client := fake.NewSimpleClientset()
+		indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+		if !tt.missingNamespace {
+			client = fake.NewSimpleClientset(namespace)
+			if err := indexer.Add(namespace); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		for _, source := range []struct {
+			name       string
+			namespaces corelisters.NamespaceLister
+		}{
+			{name: "client"},
+			{name: "lister", namespaces: corelisters.NewNamespaceLister(indexer)},
+		} {
+			t.Run(tt.name+"/"+source.name, func(t *testing.T) {
+				got, err := ResolvePolicy(context.Background(), client, source.namespaces, base, ingress)
+				if (err != nil) != tt.wantErr {
+					t.Errorf("ResolvePolicy() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				if got != tt.want {
+					t.Errorf("ResolvePolicy() = %+v, want %+v", got, tt.want)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package certificatecache
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	certmanagerwrapper "dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/cert-manager-wrapper"
+	certmanagerv1 "github.com/jetstack/cert-manager/pkg/apis/certmanager/v1"
+	cminformers "github.com/jetstack/cert-manager/pkg/client/informers/externalversions"
+	kwhlog "github.com/slok/kubewebhook/v2/pkg/log"
+	v1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/informers"
+	networkinglisters "k8s.io/client-go/listers/networking/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// reconcileTimeout bounds the Key Vault, cert-manager and Kubernetes calls of a
+// single ingress, a hanging backend must not block a worker forever.
+const reconcileTimeout = 2 * time.Minute
+
+// Reconciler drives CertificateCacheManager from Ingress and Certificate events
+// instead of periodically listing every Ingress in the cluster.
+type Reconciler struct {
+	ccm           *CertificateCacheManager
+	ingressLister networkinglisters.IngressLister
+	handlers      []eventHandler
+	queue         workqueue.RateLimitingInterface
+	logger        kwhlog.Logger
+}
+
+// eventHandler is a handler registered on a shared informer, the informers
+// outlive a leadership term so the handler is removed when Run returns.
+type eventHandler struct {
+	informer     cache.SharedIndexInformer
+	registration cache.ResourceEventHandlerRegistration
+}
+
+// NewReconciler registers event handlers on the Ingress and Certificate informers
+// of the given factories. The factories have to be started by the caller and the
+// handlers are removed once Run returns, so Run has to be called exactly once.
+func NewReconciler(ccm *CertificateCacheManager, kubeInformers informers.SharedInformerFactory, cmInformers cminformers.SharedInformerFactory, logger kwhlog.Logger) (*Reconciler, error) {
+	ingressInformer := kubeInformers.Networking().V1().Ingresses()
+	certificateInformer := cmInformers.Certmanager().V1().Certificates()
+
+	r := &Reconciler{
+		ccm:           ccm,
+		ingressLister: ingressInformer.Lister(),
+		queue:         workqueue.NewRateLimitingQueueWithConfig(workqueue.DefaultControllerRateLimiter(), workqueue.RateLimitingQueueConfig{Name: "certificatecache"}),
+		logger:        logger,
+	}
+
+	err := r.addEventHandler(ingressInformer.Informer(), cache.ResourceEventHandlerFuncs{
+		AddFunc:    r.enqueueIngress,
+		UpdateFunc: func(_, newObj interface{}) { r.enqueueIngress(newObj) },
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to add ingress event handler: %w", err)
+	}
+
+	err = r.addEventHandler(certificateInformer.Informer(), cache.ResourceEventHandlerFuncs{
+		AddFunc:    r.enqueueCertificate,
+		UpdateFunc: func(_, newObj interface{}) { r.enqueueCertificate(newObj) },
+	})
+	if err != nil {
+		r.removeEventHandlers()
+		return nil, fmt.Errorf("failed to add certificate event handler: %w", err)
+	}
+
+	return r, nil
+}
+
+func (r *Reconciler) addEventHandler(informer cache.SharedIndexInformer, handler cache.ResourceEventHandler) error {
+	registration, err := informer.AddEventHandler(handler)
+	if err != nil {
+		return err
+	}
+	r.handlers = append(r.handlers, eventHandler{informer: informer, registration: registration})
+	return nil
+}
+
+// removeEventHandlers stops the informers from calling the handlers of r, a
+// handler left behind would keep enqueueing into a queue which is shut down.
+func (r *Reconciler) removeEventHandlers() {
+	for _, h := range r.handlers {
+		err := h.informer.RemoveEventHandler(h.registration)
+		if err != nil {
+			r.logger.Warningf("failed to remove certificate cache event handler: %v", err)
+		}
+	}
+	r.handlers = nil
+}
+
+// Run processes the queue with the given number of workers until ctx is cancelled.
+// The event handlers are removed when it returns.
+func (r *Reconciler) Run(ctx context.Context, workers int) error {
+	defer utilruntime.HandleCrash()
+	defer r.queue.ShutDown()
+	defer r.removeEventHandlers()
+
+	// A registration is synced once its handler received the initial list.
+	informersSync := make([]cache.InformerSynced, 0, len(r.handlers))
+	for _, h := range r.handlers {
+		informersSync = append(informersSync, h.registration.HasSynced)
+	}
+
+	r.logger.Infof("waiting for ingress and certificate informers to sync")
+	if !cache.WaitForCacheSync(ctx.Done(), informersSync...) {
+		return fmt.Errorf("failed to wait for informer caches to sync")
+	}
+
+	r.logger.Infof("starting %d certificate cache reconcile workers", workers)
+	for i := 0; i < workers; i++ {
+		go wait.UntilWithContext(ctx, r.runWorker, time.Second)
+	}
+
+	<-ctx.Done()
+	r.logger.Infof("stopping certificate cache reconcile workers")
+	return nil
+}
+
+func (r *Reconciler) runWorker(ctx context.Context) {
+	for r.processNextItem(ctx) {
+	}
+}
+
+func (r *Reconciler) processNextItem(ctx context.Context) bool {
+	key, quit := r.queue.Get()
+	if quit {
+		return false
+	}
+	defer r.queue.Done(key)
+
+	err := r.reconcile(ctx, key.(string))
+	if err != nil {
+		r.logger.Warningf("failed to reconcile ingress %s, requeueing: %v", key, err)
+		r.queue.AddRateLimited(key)
+		return true
+	}
+
+	r.queue.Forget(key)
+	return true
+}
+
+func (r *Reconciler) reconcile(ctx context.Context, key string) error {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return nil
+	}
+
+	ingress, err := r.ingressLister.Ingresses(namespace).Get(name)
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, reconcileTimeout)
+	defer cancel()
+
+	// Objects from the lister are shared with the informer cache.
+	return r.ccm.ReconcileIngress(ctx, ingress.DeepCopy())
+}
+
+func (r *Reconciler) enqueueIngress(obj interface{}) {
+	ingress, ok := obj.(*v1.Ingress)
+	if !ok || !CachingEnabled(ingress) {
+		return
+	}
+
+	key, err := cache.MetaNamespaceKeyFunc(ingress)
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+	r.queue.Add(key)
+}
+
+// enqueueCertificate enqueues the ingresses that use a certificate once it becomes ready.
+func (r *Reconciler) enqueueCertificate(obj interface{}) {
+	cert, ok := obj.(*certmanagerv1.Certificate)
+	if !ok || !certmanagerwrapper.IsCertificateReady(cert) {
+		return
+	}
+
+	for _, ownerRef := range cert.GetOwnerReferences() {
+		if ownerRef.Kind == "Ingress" {
+			r.queue.Add(cert.Namespace + "/" + ownerRef.Name)
+		}
+	}
+
+	// Certificates created outside of ingress-shim are matched by their TLS secret.
+	ingresses, err := r.ingressLister.Ingresses(cert.Namespace).List(labels.Everything())
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+	for _, ingress := range ingresses {
+		for _, tls := range ingress.Spec.TLS {
+			if tls.SecretName == cert.Spec.SecretName {
+				r.enqueueIngress(ingress)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package certificatecache
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/apis/certcache/v1alpha1"
+	v1 "k8s.io/api/networking/v1"
+)
+
+// CacheCertsAnnotation opts an Ingress in to certificate caching.
+const CacheCertsAnnotation = "admissions.drmax.gl/cache-certs"
+
+// Ingress annotations which tracked the cache state before the CertificateCache
+// resource existed. They are migrated and removed by the manager.
+const (
+	legacyScheduledForSaveAnnotation = "admissions.drmax.gl/cert-scheduled-for-save"
+	legacyCertCachedAnnotation       = "admissions.drmax.gl/cert-cached"
+	legacyCacheStateAnnotation       = "admissions.drmax.gl/cert-cache-state"
+)
+
+var legacyStateAnnotations = []string{
+	legacyScheduledForSaveAnnotation,
+	legacyCertCachedAnnotation,
+	legacyCacheStateAnnotation,
+}
+
+// CacheKey returns the key a TLS secret is stored under in the cache backend.
+func CacheKey(secretName, namespace string) string {
+	return fmt.Sprintf("%s--%s", secretName, namespace)
+}
+
+// CachingEnabled reports whether the ingress opted in to certificate caching.
+func CachingEnabled(ingress *v1.Ingress) bool {
+	return ingress.Annotations[CacheCertsAnnotation] == "true"
+}
+
+// TLSSecretNames returns the unique secret names of all ingress spec.tls entries.
+func TLSSecretNames(ingress *v1.Ingress) []string {
+	var secretNames []string
+	seen := make(map[string]bool)
+	for _, tls := range ingress.Spec.TLS {
+		if tls.SecretName == "" || seen[tls.SecretName] {
+			continue
+		}
+		seen[tls.SecretName] = true
+		secretNames = append(secretNames, tls.SecretName)
+	}
+	return secretNames
+}
+
+// hasLegacyState reports whether the ingress still carries annotation based state.
+func hasLegacyState(ingress *v1.Ingress) bool {
+	for _, annotation := range legacyStateAnnotations {
+		if _, ok := ingress.Annotations[annotation]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// legacyPhases maps the annotation based state of every TLS secret to a phase.
+func legacyPhases(ingress *v1.Ingress) map[string]v1alpha1.CertificateCachePhase {
+	phases := make(map[string]v1alpha1.CertificateCachePhase)
+	states := make(map[string]string)
+	if raw, ok := ingress.Annotations[legacyCacheStateAnnotation]; ok && json.Unmarshal([]byte(raw), &states) == nil {
+		for secretName, state := range states {
+			switch state {
+			case "cached":
+				phases[secretName] = v1alpha1.PhaseCached
+			case "scheduled":
+				phases[secretName] = v1alpha1.PhaseScheduled
+			}
+		}
+		return phases
+	}
+
+	var phase v1alpha1.CertificateCachePhase
+	switch {
+	case ingress.Annotations[legacyCertCachedAnnotation] == "true":
+		phase = v1alpha1.PhaseCached
+	case ingress.Annotations[legacyScheduledForSaveAnnotation] == "true":
+		phase = v1alpha1.PhaseScheduled
+	default:
+		return phases
+	}
+	// The boolean annotations only ever covered the first spec.tls entry, the
+	// other secrets were never cached and wait for their certificate.
+	for i, secretName := range TLSSecretNames(ingress) {
+		if i == 0 && ingress.Spec.TLS[0].SecretName == secretName {
+			phases[secretName] = phase
+		} else {
+			phases[secretName] = v1alpha1.PhasePending
+		}
+	}
+	return phases
+}
@@ -0,0 +1,94 @@
+package certificatecache
+
+import (
+	"reflect"
+	"testing"
+
+	"dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/apis/certcache/v1alpha1"
+	v1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestLegacyPhases(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		secrets     []string
+		want        map[string]v1alpha1.CertificateCachePhase
+	}{
+		{
+			name:        "no legacy state",
+			annotations: map[string]string{CacheCertsAnnotation: "true"},
+			secrets:     []string{"a-tls"},
+			want:        map[string]v1alpha1.CertificateCachePhase{},
+		},
+		{
+			name:        "cached covers the first secret only",
+			annotations: map[string]string{legacyCertCachedAnnotation: "true"},
+			secrets:     []string{"a-tls", "b-tls", "a-tls"},
+			want: map[string]v1alpha1.CertificateCachePhase{
+				"a-tls": v1alpha1.PhaseCached,
+				"b-tls": v1alpha1.PhasePending,
+			},
+		},
+		{
+			name:        "scheduled covers the first secret only",
+			annotations: map[string]string{legacyScheduledForSaveAnnotation: "true"},
+			secrets:     []string{"a-tls", "b-tls"},
+			want: map[string]v1alpha1.CertificateCachePhase{
+				"a-tls": v1alpha1.PhaseScheduled,
+				"b-tls": v1alpha1.PhasePending,
+			},
+		},
+		{
+			name:        "cached wins over scheduled",
+			annotations: map[string]string{legacyCertCachedAnnotation: "true", legacyScheduledForSaveAnnotation: "true"},
+			secrets:     []string{"a-tls"},
+			want:        map[string]v1alpha1.CertificateCachePhase{"a-tls": v1alpha1.PhaseCached},
+		},
+		{
+			name:        "first entry without secret",
+			annotations: map[string]string{legacyCertCachedAnnotation: "true"},
+			secrets:     []string{"", "b-tls"},
+			want:        map[string]v1alpha1.CertificateCachePhase{"b-tls": v1alpha1.PhasePending},
+		},
+		{
+			name: "per secret state",
+			annotations: map[string]string{
+				legacyCacheStateAnnotation: `{"a-tls":"cached","b-tls":"scheduled","c-tls":"unknown"}`,
+				legacyCertCachedAnnotation: "true",
+			},
+			secrets: []string{"a-tls", "b-tls", "c-tls"},
+			want: map[string]v1alpha1.CertificateCachePhase{
+				"a-tls": v1alpha1.PhaseCached,
+				"b-tls": v1alpha1.PhaseScheduled,
+			},
+		},
+		{
+			name: "invalid per secret state falls back to the boolean annotations",
+			annotations: map[string]string{
+				legacyCacheStateAnnotation: `not json`,
+				legacyCertCachedAnnotation: "true",
+			},
+			secrets: []string{"a-tls", "b-tls"},
+			want: map[string]v1alpha1.CertificateCachePhase{
+				"a-tls": v1alpha1.PhaseCached,
+				"b-tls": v1alpha1.PhasePending,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ingress := &v1.Ingress{ObjectMeta: metav1.ObjectMeta{Name: "shop", Namespace: "shop", Annotations: tt.annotations}}
+			for _, secretName := range tt.secrets {
+				ingress.Spec.TLS = append(ingress.Spec.TLS, v1.IngressTLS{SecretName: secretName})
+			}
+
+			got := legacyPhases(ingress)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("legacyPhases() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
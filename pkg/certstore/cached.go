@@ -0,0 +1,156 @@
+package certstore
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/utils"
+)
+
+type lookupEntry struct {
+	exists  bool
+	expiry  time.Time
+	expires time.Time
+}
+
+// CachedStore keeps the existence and expiry of entries of the wrapped CertStore
+// in memory, so admissions do not wait for the backend on every request. Misses
+// are cached for negativeTTL only, writes through the store update the entry.
+// Certificates and keys themselves are never cached.
+type CachedStore struct {
+	store       CertStore
+	ttl         time.Duration
+	negativeTTL time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*lookupEntry
+}
+
+var _ CertStore = (*CachedStore)(nil)
+
+func NewCachedStore(store CertStore, ttl, negativeTTL time.Duration) *CachedStore {
+	return &CachedStore{
+		store:       store,
+		ttl:         ttl,
+		negativeTTL: negativeTTL,
+		entries:     make(map[string]*lookupEntry),
+	}
+}
+
+func (cs *CachedStore) lookup(secretName string) (*lookupEntry, bool) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	entry, ok := cs.entries[secretName]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(entry.expires) {
+		delete(cs.entries, secretName)
+		return nil, false
+	}
+	return entry, true
+}
+
+// set caches the entry, an existing entry without a known expiry is kept only
+// for SecretExists and GetCertificateExpiry asks the backend.
+func (cs *CachedStore) set(secretName string, exists bool, expiry time.Time) {
+	ttl := cs.ttl
+	if !exists {
+		ttl = cs.negativeTTL
+	}
+	if ttl <= 0 {
+		cs.invalidate(secretName)
+		return
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.entries[secretName] = &lookupEntry{exists: exists, expiry: expiry, expires: time.Now().Add(ttl)}
+}
+
+func (cs *CachedStore) invalidate(secretName string) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	delete(cs.entries, secretName)
+}
+
+func (cs *CachedStore) StoreSecret(ctx context.Context, secretName string, cert, key []byte) error {
+	err := cs.store.StoreSecret(ctx, secretName, cert, key)
+	if err != nil {
+		cs.invalidate(secretName)
+		return err
+	}
+	expiry, err := utils.GetFirstCertExpiryFromPEM(cert)
+	if err != nil {
+		cs.invalidate(secretName)
+		return nil
+	}
+	cs.set(secretName, true, expiry)
+	return nil
+}
+
+// GetSecret always reads the backend, the result refreshes the cached entry.
+func (cs *CachedStore) GetSecret(ctx context.Context, secretName string) ([]byte, []byte, error) {
+	cert, key, err := cs.store.GetSecret(ctx, secretName)
+	if errors.Is(err, ErrNotFound) {
+		// Removed by another replica, remembered as a miss
+		cs.set(secretName, false, time.Time{})
+		return nil, nil, err
+	}
+	if err != nil {
+		cs.invalidate(secretName)
+		return nil, nil, err
+	}
+	expiry, err := utils.GetFirstCertExpiryFromPEM(cert)
+	if err != nil {
+		cs.set(secretName, true, time.Time{})
+	} else {
+		cs.set(secretName, true, expiry)
+	}
+	return cert, key, nil
+}
+
+func (cs *CachedStore) GetCertificateExpiry(ctx context.Context, secretName string) (time.Time, error) {
+	if entry, ok := cs.lookup(secretName); ok && entry.exists && !entry.expiry.IsZero() {
+		return entry.expiry, nil
+	}
+	expiry, err := cs.store.GetCertificateExpiry(ctx, secretName)
+	if errors.Is(err, ErrNotFound) {
+		cs.set(secretName, false, time.Time{})
+		return time.Time{}, err
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	cs.set(secretName, true, expiry)
+	return expiry, nil
+}
+
+func (cs *CachedStore) SecretExists(ctx context.Context, secretName string) (bool, error) {
+	if entry, ok := cs.lookup(secretName); ok {
+		return entry.exists, nil
+	}
+	exists, err := cs.store.SecretExists(ctx, secretName)
+	if err != nil {
+		return false, err
+	}
+	cs.set(secretName, exists, time.Time{})
+	return exists, nil
+}
+
+func (cs *CachedStore) DeleteSecret(ctx context.Context, secretName string) error {
+	defer cs.invalidate(secretName)
+	return cs.store.DeleteSecret(ctx, secretName)
+}
+
+func (cs *CachedStore) ListSecretsPendingPurge(ctx context.Context) ([]string, error) {
+	return cs.store.ListSecretsPendingPurge(ctx)
+}
+
+func (cs *CachedStore) PurgerDeletedSecret(ctx context.Context, secretName string) error {
+	defer cs.invalidate(secretName)
+	return cs.store.PurgerDeletedSecret(ctx, secretName)
+}
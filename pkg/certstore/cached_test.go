@@ -0,0 +1,207 @@
+package certstore
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// countingStore counts the calls reaching the backend, err fails them.
+type countingStore struct {
+	*MemoryStore
+	calls int
+	err   error
+}
+
+func (s *countingStore) GetCertificateExpiry(ctx context.Context, secretName string) (time.Time, error) {
+	s.calls++
+	if s.err != nil {
+		return time.Time{}, s.err
+	}
+	return s.MemoryStore.GetCertificateExpiry(ctx, secretName)
+}
+
+func (s *countingStore) SecretExists(ctx context.Context, secretName string) (bool, error) {
+	s.calls++
+	if s.err != nil {
+		return false, s.err
+	}
+	return s.MemoryStore.SecretExists(ctx, secretName)
+}
+
+func testCertificate(t *testing.T, notAfter time.Time) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "example.com"},
+		DNSNames:     []string{"example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func TestCachedStore(t *testing.T) {
+	const (
+		ttl         = 50 * time.Millisecond
+		negativeTTL = 20 * time.Millisecond
+		secretName  = "tls--default"
+	)
+	notAfter := time.Now().Add(90 * 24 * time.Hour).Truncate(time.Second).UTC()
+	cert := testCertificate(t, notAfter)
+	errBackend := NewError(ErrUnavailable, errors.New("connection refused"))
+
+	type step struct {
+		name      string
+		do        func(cs *CachedStore, backend *countingStore) error
+		wait      time.Duration
+		wantCalls int
+	}
+	exists := func(want bool) func(*CachedStore, *countingStore) error {
+		return func(cs *CachedStore, _ *countingStore) error {
+			got, err := cs.SecretExists(context.Background(), secretName)
+			if err != nil {
+				return err
+			}
+			if got != want {
+				return errors.New("unexpected existence")
+			}
+			return nil
+		}
+	}
+	expiry := func(cs *CachedStore, _ *countingStore) error {
+		got, err := cs.GetCertificateExpiry(context.Background(), secretName)
+		if err != nil {
+			return err
+		}
+		if !got.Equal(notAfter) {
+			return errors.New("unexpected expiry")
+		}
+		return nil
+	}
+	missing := func(cs *CachedStore, _ *countingStore) error {
+		_, err := cs.GetCertificateExpiry(context.Background(), secretName)
+		if !errors.Is(err, ErrNotFound) {
+			return errors.New("expected not found")
+		}
+		return nil
+	}
+	failing := func(cs *CachedStore, backend *countingStore) error {
+		backend.err = errBackend
+		defer func() { backend.err = nil }()
+		_, err := cs.SecretExists(context.Background(), secretName)
+		if !errors.Is(err, ErrUnavailable) {
+			return errors.New("expected unavailable")
+		}
+		return nil
+	}
+	store := func(cs *CachedStore, _ *countingStore) error {
+		return cs.StoreSecret(context.Background(), secretName, cert, []byte("key"))
+	}
+	storeBehind := func(_ *CachedStore, backend *countingStore) error {
+		return backend.MemoryStore.StoreSecret(context.Background(), secretName, cert, []byte("key"))
+	}
+
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "hit within the ttl",
+			steps: []step{
+				{name: "store", do: store},
+				{name: "exists", do: exists(true), wantCalls: 0},
+				{name: "expiry", do: expiry, wantCalls: 0},
+			},
+		},
+		{
+			name: "expired entry asks the backend",
+			steps: []step{
+				{name: "store", do: store},
+				{name: "expiry after ttl", do: expiry, wait: ttl, wantCalls: 1},
+				{name: "expiry cached again", do: expiry, wantCalls: 1},
+			},
+		},
+		{
+			name: "miss is cached for the negative ttl",
+			steps: []step{
+				{name: "missing", do: exists(false), wantCalls: 1},
+				{name: "missing cached", do: exists(false), wantCalls: 1},
+				{name: "stored by another replica", do: storeBehind, wantCalls: 1},
+				{name: "still missing", do: exists(false), wantCalls: 1},
+				{name: "seen after negative ttl", do: exists(true), wait: negativeTTL, wantCalls: 2},
+			},
+		},
+		{
+			name: "not found is cached as a miss",
+			steps: []step{
+				{name: "expiry not found", do: missing, wantCalls: 1},
+				{name: "exists from cache", do: exists(false), wantCalls: 1},
+			},
+		},
+		{
+			name: "errors are not cached",
+			steps: []step{
+				{name: "failing backend", do: failing, wantCalls: 1},
+				{name: "backend asked again", do: exists(false), wantCalls: 2},
+			},
+		},
+		{
+			name: "delete invalidates the entry",
+			steps: []step{
+				{name: "store", do: store},
+				{name: "delete", do: func(cs *CachedStore, _ *countingStore) error {
+					return cs.DeleteSecret(context.Background(), secretName)
+				}},
+				{name: "missing", do: exists(false), wantCalls: 1},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := &countingStore{MemoryStore: NewMemoryStore()}
+			cs := NewCachedStore(backend, ttl, negativeTTL)
+			for _, s := range tt.steps {
+				time.Sleep(s.wait)
+				if err := s.do(cs, backend); err != nil {
+					t.Fatalf("%s: %v", s.name, err)
+				}
+				if backend.calls != s.wantCalls {
+					t.Fatalf("%s: backend calls = %d, want %d", s.name, backend.calls, s.wantCalls)
+				}
+			}
+		})
+	}
+}
+
+func TestCachedStoreDisabled(t *testing.T) {
+	backend := &countingStore{MemoryStore: NewMemoryStore()}
+	cs := NewCachedStore(backend, 0, 0)
+
+	for i := 1; i <= 2; i++ {
+		exists, err := cs.SecretExists(context.Background(), "tls--default")
+		if err != nil || exists {
+			t.Fatalf("SecretExists = %t, %v, want false", exists, err)
+		}
+		if backend.calls != i {
+			t.Fatalf("backend calls = %d, want %d", backend.calls, i)
+		}
+	}
+}
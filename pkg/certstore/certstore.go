@@ -0,0 +1,87 @@
+package certstore
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/utils"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// CertStore is a backend the certificate cache keeps certificates and their keys in.
+// Entries are addressed by the cache key "<secretName>--<namespace>".
+type CertStore interface {
+	StoreSecret(ctx context.Context, secretName string, cert, key []byte) error
+	GetSecret(ctx context.Context, secretName string) ([]byte, []byte, error)
+	GetCertificateExpiry(ctx context.Context, secretName string) (time.Time, error)
+	SecretExists(ctx context.Context, secretName string) (bool, error)
+	DeleteSecret(ctx context.Context, secretName string) error
+	ListSecretsPendingPurge(ctx context.Context) ([]string, error)
+	PurgerDeletedSecret(ctx context.Context, secretName string) error
+}
+
+// SaveSecretToK8s restores a cached certificate from the store as a TLS Secret
+// which cert-manager accepts as issued for the given Certificate.
+func SaveSecretToK8s(ctx context.Context, store CertStore, clientset kubernetes.Interface, secretName, secretNameKube, certificateName, namespace string) error {
+	cert, key, err := store.GetSecret(ctx, secretName)
+	if err != nil {
+		return fmt.Errorf("failed to get secret from cache: %w", err)
+	}
+
+	commonName, altNames, err := utils.GetFirstCertDetailsFromPEM(cert)
+	if err != nil {
+		return NewError(ErrCorrupt, fmt.Errorf("failed to parse certificate: %w", err))
+	}
+
+	secret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      secretNameKube,
+			Namespace: namespace,
+			Labels: map[string]string{
+				"controller.cert-manager.io/fao": "true",
+			},
+			Annotations: map[string]string{
+				"cert-manager.io/alt-names":        strings.Join(altNames, ","),
+				"cert-manager.io/common-name":      commonName,
+				"cert-manager.io/certificate-name": certificateName,
+				"cert-manager.io/ip-sans":          "",
+				"cert-manager.io/uri-sans":         "",
+				"cert-manager.io/issuer-name":      "cert-manager",
+				"cert-manager.io/issuer-kind":      "ClusterIssuer",
+				"cert-manager.io/issuer-group":     "cert-manager.io",
+			},
+		},
+		Data: map[string][]byte{
+			"tls.crt": cert,
+			"tls.key": key,
+		},
+		Type: v1.SecretTypeTLS,
+	}
+
+	existingSecret, err := clientset.CoreV1().Secrets(namespace).Get(ctx, secretNameKube, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = clientset.CoreV1().Secrets(namespace).Create(ctx, secret, metav1.CreateOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to create Kubernetes secret: %w", err)
+		}
+		return nil
+	}
+	// Only a missing Secret is created, a failed read must not end up as a failed create
+	if err != nil {
+		return fmt.Errorf("failed to get Kubernetes secret: %w", secretStoreError(err))
+	}
+
+	existingSecret.Data = secret.Data
+	existingSecret.Labels = secret.Labels
+	existingSecret.Annotations = secret.Annotations
+	_, err = clientset.CoreV1().Secrets(namespace).Update(ctx, existingSecret, metav1.UpdateOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to update Kubernetes secret: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package certstore
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestSaveSecretToK8s(t *testing.T) {
+	resource := schema.GroupResource{Resource: "secrets"}
+	existing := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "shop-tls", Namespace: "shop"},
+		Data:       map[string][]byte{"tls.crt": []byte("old")},
+	}
+
+	tests := []struct {
+		name       string
+		objects    []runtime.Object
+		getErr     error
+		wantKind   error
+		wantErr    bool
+		wantAction string
+	}{
+		{name: "missing secret is created", wantAction: "create"},
+		{name: "existing secret is updated", objects: []runtime.Object{existing}, wantAction: "update"},
+		{
+			name:     "forbidden read",
+			getErr:   apierrors.NewForbidden(resource, "shop-tls", errors.New("rbac")),
+			wantErr:  true,
+			wantKind: ErrForbidden,
+		},
+		{
+			name:     "timed out read",
+			getErr:   apierrors.NewTimeoutError("slow", 1),
+			wantErr:  true,
+			wantKind: ErrUnavailable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewMemoryStore()
+			cert := testCertificate(t, time.Now().Add(24*time.Hour))
+			if err := store.StoreSecret(context.Background(), "shop-tls--shop", cert, []byte("key")); err != nil {
+				t.Fatal(err)
+			}
+			client := fake.NewSimpleClientset(tt.objects...)
+			if tt.getErr != nil {
+				client.PrependReactor("get", "secrets", func(k8stesting.Action) (bool, runtime.Object, error) {
+					return true, nil, tt.getErr
+				})
+			}
+
+			err := SaveSecretToK8s(context.Background(), store, client, "shop-tls--shop", "shop-tls", "shop-cert", "shop")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SaveSecretToK8s() error = %v, want error %t", err, tt.wantErr)
+			}
+			if kind := Kind(err); kind != tt.wantKind {
+				t.Errorf("error kind = %v, want %v", kind, tt.wantKind)
+			}
+
+			var writes []string
+			for _, action := range client.Actions() {
+				if verb := action.GetVerb(); verb == "create" || verb == "update" {
+					writes = append(writes, verb)
+				}
+			}
+			if tt.wantAction == "" && len(writes) != 0 {
+				t.Errorf("writes = %v, want none after a failed read", writes)
+			}
+			if tt.wantAction != "" && (len(writes) != 1 || writes[0] != tt.wantAction) {
+				t.Errorf("writes = %v, want [%s]", writes, tt.wantAction)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			secret, err := client.CoreV1().Secrets("shop").Get(context.Background(), "shop-tls", metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(secret.Data["tls.crt"]) != string(cert) || secret.Annotations["cert-manager.io/certificate-name"] != "shop-cert" {
+				t.Error("restored secret does not hold the cached certificate for shop-cert")
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package certstore
+
+import (
+	"context"
+	"time"
+
+	"dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/plan"
+)
+
+// DryRunStore reads from the wrapped CertStore and records writes in the plan
+// instead of executing them.
+type DryRunStore struct {
+	store CertStore
+	plan  *plan.Plan
+}
+
+var _ CertStore = (*DryRunStore)(nil)
+
+func NewDryRunStore(store CertStore, p *plan.Plan) *DryRunStore {
+	return &DryRunStore{store: store, plan: p}
+}
+
+func (ds *DryRunStore) StoreSecret(_ context.Context, secretName string, _, _ []byte) error {
+	ds.plan.Record("CertStore", plan.OperationStoreSecret, secretName, "")
+	return nil
+}
+
+func (ds *DryRunStore) GetSecret(ctx context.Context, secretName string) ([]byte, []byte, error) {
+	return ds.store.GetSecret(ctx, secretName)
+}
+
+func (ds *DryRunStore) GetCertificateExpiry(ctx context.Context, secretName string) (time.Time, error) {
+	return ds.store.GetCertificateExpiry(ctx, secretName)
+}
+
+func (ds *DryRunStore) SecretExists(ctx context.Context, secretName string) (bool, error) {
+	return ds.store.SecretExists(ctx, secretName)
+}
+
+func (ds *DryRunStore) DeleteSecret(_ context.Context, secretName string) error {
+	ds.plan.Record("CertStore", plan.OperationDeleteSecret, secretName, "")
+	return nil
+}
+
+func (ds *DryRunStore) ListSecretsPendingPurge(ctx context.Context) ([]string, error) {
+	return ds.store.ListSecretsPendingPurge(ctx)
+}
+
+func (ds *DryRunStore) PurgerDeletedSecret(_ context.Context, secretName string) error {
+	ds.plan.Record("CertStore", plan.OperationPurgeSecret, secretName, "")
+	return nil
+}
@@ -0,0 +1,77 @@
+package certstore
+
+import "errors"
+
+// Kinds of backend errors. The backends wrap the errors of their calls in an
+// Error of one of the kinds, so a missing entry can be told apart from a failing
+// backend with errors.Is, e.g. errors.Is(err, certstore.ErrNotFound).
+var (
+	// ErrNotFound is returned for an entry which is not cached or is deleted.
+	ErrNotFound = errors.New("not found")
+	// ErrForbidden is returned when the backend rejects the credentials of the operator.
+	ErrForbidden = errors.New("forbidden")
+	// ErrThrottled is returned when the backend rejects calls over its rate limit.
+	ErrThrottled = errors.New("throttled")
+	// ErrUnavailable is returned when the backend can not be reached or fails to answer.
+	ErrUnavailable = errors.New("unavailable")
+	// ErrCorrupt is returned for an entry which can not be decoded.
+	ErrCorrupt = errors.New("corrupt")
+)
+
+// Error is a backend error of a known Kind, one of the Err* values.
+type Error struct {
+	Kind error
+	Err  error
+}
+
+// NewError wraps err in an Error of kind. An error which already has a kind is
+// returned as it is, so the kind set closest to the backend wins.
+func NewError(kind, err error) error {
+	if err == nil || Kind(err) != nil {
+		return err
+	}
+	return &Error{Kind: kind, Err: err}
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns both the kind and the wrapped error, errors.Is matches either
+// and errors.As still finds the error of the backend SDK.
+func (e *Error) Unwrap() []error {
+	return []error{e.Kind, e.Err}
+}
+
+// Kind returns the kind of a backend error or nil when it has none.
+func Kind(err error) error {
+	var typed *Error
+	if errors.As(err, &typed) {
+		return typed.Kind
+	}
+	return nil
+}
+
+// KindName returns the kind of a backend error for metric labels and logs,
+// "unknown" when it has none.
+func KindName(err error) string {
+	switch Kind(err) {
+	case ErrNotFound:
+		return "not_found"
+	case ErrForbidden:
+		return "forbidden"
+	case ErrThrottled:
+		return "throttled"
+	case ErrUnavailable:
+		return "unavailable"
+	case ErrCorrupt:
+		return "corrupt"
+	}
+	return "unknown"
+}
+
+// IsTransient reports whether the backend was throttled or unavailable, the
+// call may succeed when it is retried later.
+func IsTransient(err error) bool {
+	return errors.Is(err, ErrThrottled) || errors.Is(err, ErrUnavailable)
+}
@@ -0,0 +1,77 @@
+package certstore
+
+import (
+	"context"
+	"time"
+)
+
+// BackendRecorder records the latency and outcome of cache backend calls.
+type BackendRecorder interface {
+	ObserveBackendRequest(backend, operation string, duration time.Duration, err error)
+}
+
+// InstrumentedStore measures every call to the wrapped CertStore.
+type InstrumentedStore struct {
+	store    CertStore
+	backend  string
+	recorder BackendRecorder
+}
+
+var _ CertStore = (*InstrumentedStore)(nil)
+
+func NewInstrumentedStore(store CertStore, backend string, recorder BackendRecorder) *InstrumentedStore {
+	return &InstrumentedStore{store: store, backend: backend, recorder: recorder}
+}
+
+func (is *InstrumentedStore) observe(operation string, start time.Time, err error) {
+	is.recorder.ObserveBackendRequest(is.backend, operation, time.Since(start), err)
+}
+
+func (is *InstrumentedStore) StoreSecret(ctx context.Context, secretName string, cert, key []byte) error {
+	start := time.Now()
+	err := is.store.StoreSecret(ctx, secretName, cert, key)
+	is.observe("store", start, err)
+	return err
+}
+
+func (is *InstrumentedStore) GetSecret(ctx context.Context, secretName string) ([]byte, []byte, error) {
+	start := time.Now()
+	cert, key, err := is.store.GetSecret(ctx, secretName)
+	is.observe("get", start, err)
+	return cert, key, err
+}
+
+func (is *InstrumentedStore) GetCertificateExpiry(ctx context.Context, secretName string) (time.Time, error) {
+	start := time.Now()
+	expiry, err := is.store.GetCertificateExpiry(ctx, secretName)
+	is.observe("get_expiry", start, err)
+	return expiry, err
+}
+
+func (is *InstrumentedStore) SecretExists(ctx context.Context, secretName string) (bool, error) {
+	start := time.Now()
+	exists, err := is.store.SecretExists(ctx, secretName)
+	is.observe("exists", start, err)
+	return exists, err
+}
+
+func (is *InstrumentedStore) DeleteSecret(ctx context.Context, secretName string) error {
+	start := time.Now()
+	err := is.store.DeleteSecret(ctx, secretName)
+	is.observe("delete", start, err)
+	return err
+}
+
+func (is *InstrumentedStore) ListSecretsPendingPurge(ctx context.Context) ([]string, error) {
+	start := time.Now()
+	secrets, err := is.store.ListSecretsPendingPurge(ctx)
+	is.observe("list_pending_purge", start, err)
+	return secrets, err
+}
+
+func (is *InstrumentedStore) PurgerDeletedSecret(ctx context.Context, secretName string) error {
+	start := time.Now()
+	err := is.store.PurgerDeletedSecret(ctx, secretName)
+	is.observe("purge", start, err)
+	return err
+}
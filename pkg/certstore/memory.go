@@ -0,0 +1,110 @@
+package certstore
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/utils"
+)
+
+type memoryEntry struct {
+	cert    []byte
+	key     []byte
+	deleted bool
+}
+
+// MemoryStore keeps the cache in process memory. It emulates the Key Vault soft
+// delete so the purge job behaves the same. Meant for local development and CI.
+type MemoryStore struct {
+	mu      sync.RWMutex
+	entries map[string]*memoryEntry
+}
+
+var _ CertStore = (*MemoryStore)(nil)
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]*memoryEntry)}
+}
+
+func (ms *MemoryStore) StoreSecret(_ context.Context, secretName string, cert, key []byte) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.entries[secretName] = &memoryEntry{
+		cert: append([]byte(nil), cert...),
+		key:  append([]byte(nil), key...),
+	}
+	return nil
+}
+
+func (ms *MemoryStore) GetSecret(_ context.Context, secretName string) ([]byte, []byte, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	entry, ok := ms.entries[secretName]
+	if !ok || entry.deleted {
+		return nil, nil, NewError(ErrNotFound, fmt.Errorf("failed to get secret: secret %s not found", secretName))
+	}
+	return append([]byte(nil), entry.cert...), append([]byte(nil), entry.key...), nil
+}
+
+func (ms *MemoryStore) GetCertificateExpiry(ctx context.Context, secretName string) (time.Time, error) {
+	cert, _, err := ms.GetSecret(ctx, secretName)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get secret: %w", err)
+	}
+
+	expiry, err := utils.GetFirstCertExpiryFromPEM(cert)
+	if err != nil {
+		return time.Time{}, NewError(ErrCorrupt, fmt.Errorf("failed to parse certificate: %w", err))
+	}
+
+	return expiry, nil
+}
+
+func (ms *MemoryStore) SecretExists(_ context.Context, secretName string) (bool, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	entry, ok := ms.entries[secretName]
+	return ok && !entry.deleted, nil
+}
+
+func (ms *MemoryStore) DeleteSecret(_ context.Context, secretName string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if entry, ok := ms.entries[secretName]; ok {
+		entry.deleted = true
+	}
+	return nil
+}
+
+func (ms *MemoryStore) ListSecretsPendingPurge(_ context.Context) ([]string, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	var secretsPendingPurge []string
+	for name, entry := range ms.entries {
+		if entry.deleted {
+			secretsPendingPurge = append(secretsPendingPurge, name)
+		}
+	}
+	sort.Strings(secretsPendingPurge)
+	return secretsPendingPurge, nil
+}
+
+func (ms *MemoryStore) PurgerDeletedSecret(_ context.Context, secretName string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	entry, ok := ms.entries[secretName]
+	if !ok || !entry.deleted {
+		return fmt.Errorf("failed to purge secret: secret %s is not deleted", secretName)
+	}
+	delete(ms.entries, secretName)
+	return nil
+}
@@ -0,0 +1,234 @@
+package certstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/utils"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+const (
+	secretStoreType = v1.SecretType("admissions.drmax.gl/certificate-cache")
+
+	secretStoreLabel         = "admissions.drmax.gl/certificate-cache"
+	secretStoreNotAfterLabel = "admissions.drmax.gl/not-after"
+	secretStoreDeletedLabel  = "admissions.drmax.gl/deleted"
+
+	// SANs may contain wildcards and commas which are not valid label values.
+	secretStoreSANsAnnotation      = "admissions.drmax.gl/sans"
+	secretStoreDeletedAtAnnotation = "admissions.drmax.gl/deleted-at"
+)
+
+// SecretStore keeps the cache as Secrets in a hub namespace, either in the local
+// cluster or in a remote hub cluster. Deleted entries are only labeled and are
+// removed by the purge job, which mirrors the Key Vault soft delete.
+type SecretStore struct {
+	client    kubernetes.Interface
+	namespace string
+}
+
+var _ CertStore = (*SecretStore)(nil)
+
+func NewSecretStore(client kubernetes.Interface, namespace string) *SecretStore {
+	return &SecretStore{client: client, namespace: namespace}
+}
+
+func (ss *SecretStore) StoreSecret(ctx context.Context, secretName string, cert, key []byte) error {
+	expiry, err := utils.GetFirstCertExpiryFromPEM(cert)
+	if err != nil {
+		return fmt.Errorf("failed to parse certificate: %w", err)
+	}
+	_, altNames, err := utils.GetFirstCertDetailsFromPEM(cert)
+	if err != nil {
+		return fmt.Errorf("failed to parse certificate: %w", err)
+	}
+
+	labels := map[string]string{
+		secretStoreLabel:         "true",
+		secretStoreNotAfterLabel: strconv.FormatInt(expiry.Unix(), 10),
+	}
+	annotations := map[string]string{
+		secretStoreSANsAnnotation: strings.Join(altNames, ","),
+	}
+	data := map[string][]byte{
+		v1.TLSCertKey:       cert,
+		v1.TLSPrivateKeyKey: key,
+	}
+
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		existing, err := ss.client.CoreV1().Secrets(ss.namespace).Get(ctx, secretName, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			_, err = ss.client.CoreV1().Secrets(ss.namespace).Create(ctx, &v1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        secretName,
+					Namespace:   ss.namespace,
+					Labels:      labels,
+					Annotations: annotations,
+				},
+				Data: data,
+				Type: secretStoreType,
+			}, metav1.CreateOptions{})
+			return err
+		}
+		if err != nil {
+			return err
+		}
+
+		existing.Labels = labels
+		existing.Annotations = annotations
+		existing.Data = data
+		_, err = ss.client.CoreV1().Secrets(ss.namespace).Update(ctx, existing, metav1.UpdateOptions{})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to store secret: %w", secretStoreError(err))
+	}
+	return nil
+}
+
+// getActiveSecret returns the cache entry or nil when it does not exist or is deleted.
+func (ss *SecretStore) getActiveSecret(ctx context.Context, secretName string) (*v1.Secret, error) {
+	secret, err := ss.client.CoreV1().Secrets(ss.namespace).Get(ctx, secretName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, secretStoreError(err)
+	}
+	if secret.Labels[secretStoreLabel] != "true" || secret.Labels[secretStoreDeletedLabel] == "true" {
+		return nil, nil
+	}
+	return secret, nil
+}
+
+func (ss *SecretStore) GetSecret(ctx context.Context, secretName string) ([]byte, []byte, error) {
+	secret, err := ss.getActiveSecret(ctx, secretName)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get secret: %w", err)
+	}
+	if secret == nil {
+		return nil, nil, NewError(ErrNotFound, fmt.Errorf("failed to get secret: secret %s not found in namespace %s", secretName, ss.namespace))
+	}
+	cert, key := secret.Data[v1.TLSCertKey], secret.Data[v1.TLSPrivateKeyKey]
+	if len(cert) == 0 || len(key) == 0 {
+		return nil, nil, NewError(ErrCorrupt, fmt.Errorf("secret %s does not contain %s and %s", secretName, v1.TLSCertKey, v1.TLSPrivateKeyKey))
+	}
+	return cert, key, nil
+}
+
+// GetCertificateExpiry reads the expiry from the label without decoding the certificate.
+func (ss *SecretStore) GetCertificateExpiry(ctx context.Context, secretName string) (time.Time, error) {
+	secret, err := ss.getActiveSecret(ctx, secretName)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get secret: %w", err)
+	}
+	if secret == nil {
+		return time.Time{}, NewError(ErrNotFound, fmt.Errorf("failed to get secret: secret %s not found in namespace %s", secretName, ss.namespace))
+	}
+
+	notAfter, err := strconv.ParseInt(secret.Labels[secretStoreNotAfterLabel], 10, 64)
+	if err != nil {
+		// Fall back to the certificate itself when the label was tampered with.
+		expiry, err := utils.GetFirstCertExpiryFromPEM(secret.Data[v1.TLSCertKey])
+		if err != nil {
+			return time.Time{}, NewError(ErrCorrupt, fmt.Errorf("failed to parse certificate: %w", err))
+		}
+		return expiry, nil
+	}
+	return time.Unix(notAfter, 0), nil
+}
+
+func (ss *SecretStore) SecretExists(ctx context.Context, secretName string) (bool, error) {
+	secret, err := ss.getActiveSecret(ctx, secretName)
+	if err != nil {
+		return false, fmt.Errorf("failed to check secret in namespace %s: %w", ss.namespace, err)
+	}
+	return secret != nil, nil
+}
+
+func (ss *SecretStore) DeleteSecret(ctx context.Context, secretName string) error {
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		secret, err := ss.getActiveSecret(ctx, secretName)
+		if err != nil || secret == nil {
+			return err
+		}
+
+		secret.Labels[secretStoreDeletedLabel] = "true"
+		if secret.Annotations == nil {
+			secret.Annotations = make(map[string]string)
+		}
+		secret.Annotations[secretStoreDeletedAtAnnotation] = time.Now().UTC().Format(time.RFC3339)
+		_, err = ss.client.CoreV1().Secrets(ss.namespace).Update(ctx, secret, metav1.UpdateOptions{})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete secret: %w", secretStoreError(err))
+	}
+	return nil
+}
+
+func (ss *SecretStore) ListSecretsPendingPurge(ctx context.Context) ([]string, error) {
+	secretList, err := ss.client.CoreV1().Secrets(ss.namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=true,%s=true", secretStoreLabel, secretStoreDeletedLabel),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list deleted secrets: %w", secretStoreError(err))
+	}
+
+	secretsPendingPurge := make([]string, 0, len(secretList.Items))
+	for _, secret := range secretList.Items {
+		secretsPendingPurge = append(secretsPendingPurge, secret.Name)
+	}
+	sort.Strings(secretsPendingPurge)
+	return secretsPendingPurge, nil
+}
+
+func (ss *SecretStore) PurgerDeletedSecret(ctx context.Context, secretName string) error {
+	secret, err := ss.client.CoreV1().Secrets(ss.namespace).Get(ctx, secretName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to purge secret: %w", secretStoreError(err))
+	}
+	if secret.Labels[secretStoreDeletedLabel] != "true" {
+		return fmt.Errorf("failed to purge secret: secret %s is not deleted", secretName)
+	}
+
+	// Guard against purging an entry which was stored again in the meantime.
+	err = ss.client.CoreV1().Secrets(ss.namespace).Delete(ctx, secretName, metav1.DeleteOptions{
+		Preconditions: &metav1.Preconditions{ResourceVersion: &secret.ResourceVersion},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to purge secret: %w", secretStoreError(err))
+	}
+	return nil
+}
+
+// secretStoreError gives the error of an API server call its kind. Connection
+// failures are unavailable, a cancelled call and a conflict have no kind.
+func secretStoreError(err error) error {
+	var status apierrors.APIStatus
+	switch {
+	case err == nil || errors.Is(err, context.Canceled):
+		return err
+	case apierrors.IsNotFound(err):
+		return NewError(ErrNotFound, err)
+	case apierrors.IsForbidden(err) || apierrors.IsUnauthorized(err):
+		return NewError(ErrForbidden, err)
+	case apierrors.IsTooManyRequests(err):
+		return NewError(ErrThrottled, err)
+	case apierrors.IsServiceUnavailable(err) || apierrors.IsInternalError(err) || apierrors.IsServerTimeout(err) || apierrors.IsTimeout(err):
+		return NewError(ErrUnavailable, err)
+	case !errors.As(err, &status):
+		return NewError(ErrUnavailable, err)
+	}
+	return err
+}
@@ -0,0 +1,116 @@
+package certstore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestSecretStore(t *testing.T) {
+	ctx := context.Background()
+	notAfter := time.Now().Add(90 * 24 * time.Hour).Truncate(time.Second).UTC()
+	cert := testCertificate(t, notAfter)
+	key := []byte("key")
+	const secretName = "shop-tls--shop"
+	ss := NewSecretStore(fake.NewSimpleClientset(), "certificate-cache")
+
+	_, _, err := ss.GetSecret(ctx, secretName)
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("GetSecret() before store error = %v, want not found", err)
+	}
+
+	err = ss.StoreSecret(ctx, secretName, cert, key)
+	if err != nil {
+		t.Fatalf("StoreSecret() error = %v", err)
+	}
+	gotCert, gotKey, err := ss.GetSecret(ctx, secretName)
+	if err != nil || !bytes.Equal(gotCert, cert) || !bytes.Equal(gotKey, key) {
+		t.Fatalf("GetSecret() = %v, does not return the stored certificate and key", err)
+	}
+	expiry, err := ss.GetCertificateExpiry(ctx, secretName)
+	if err != nil || !expiry.Equal(notAfter) {
+		t.Errorf("GetCertificateExpiry() = %s, %v, want %s", expiry, err, notAfter)
+	}
+
+	err = ss.DeleteSecret(ctx, secretName)
+	if err != nil {
+		t.Fatalf("DeleteSecret() error = %v", err)
+	}
+	exists, err := ss.SecretExists(ctx, secretName)
+	if err != nil || exists {
+		t.Errorf("SecretExists() after delete = %t, %v, want false", exists, err)
+	}
+	pending, err := ss.ListSecretsPendingPurge(ctx)
+	if err != nil || len(pending) != 1 || pending[0] != secretName {
+		t.Fatalf("ListSecretsPendingPurge() = %v, %v, want [%s]", pending, err, secretName)
+	}
+
+	err = ss.PurgerDeletedSecret(ctx, secretName)
+	if err != nil {
+		t.Fatalf("PurgerDeletedSecret() error = %v", err)
+	}
+	_, err = ss.GetCertificateExpiry(ctx, secretName)
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetCertificateExpiry() after purge error = %v, want not found", err)
+	}
+}
+
+// TestSecretStoreErrors checks the kind of the errors returned when the API
+// server of the hub fails the calls of the store.
+func TestSecretStoreErrors(t *testing.T) {
+	resource := schema.GroupResource{Resource: "secrets"}
+
+	tests := []struct {
+		name     string
+		err      error
+		wantKind error
+	}{
+		{name: "forbidden", err: apierrors.NewForbidden(resource, "shop-tls--shop", errors.New("rbac")), wantKind: ErrForbidden},
+		{name: "unauthorized", err: apierrors.NewUnauthorized("token expired"), wantKind: ErrForbidden},
+		{name: "too many requests", err: apierrors.NewTooManyRequests("slow down", 1), wantKind: ErrThrottled},
+		{name: "service unavailable", err: apierrors.NewServiceUnavailable("etcd"), wantKind: ErrUnavailable},
+		{name: "timeout", err: apierrors.NewTimeoutError("slow", 1), wantKind: ErrUnavailable},
+		{name: "connection refused", err: errors.New("dial tcp: connection refused"), wantKind: ErrUnavailable},
+		{name: "cancelled", err: context.Canceled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := fake.NewSimpleClientset()
+			client.PrependReactor("*", "secrets", func(k8stesting.Action) (bool, runtime.Object, error) {
+				return true, nil, tt.err
+			})
+			ss := NewSecretStore(client, "certificate-cache")
+
+			ctx := context.Background()
+			cert := testCertificate(t, time.Now().Add(time.Hour))
+			calls := []struct {
+				name string
+				call func() error
+			}{
+				{name: "GetSecret", call: func() error { _, _, err := ss.GetSecret(ctx, "shop-tls--shop"); return err }},
+				{name: "SecretExists", call: func() error { _, err := ss.SecretExists(ctx, "shop-tls--shop"); return err }},
+				{name: "StoreSecret", call: func() error { return ss.StoreSecret(ctx, "shop-tls--shop", cert, []byte("key")) }},
+				{name: "DeleteSecret", call: func() error { return ss.DeleteSecret(ctx, "shop-tls--shop") }},
+				{name: "ListSecretsPendingPurge", call: func() error { _, err := ss.ListSecretsPendingPurge(ctx); return err }},
+			}
+			for _, c := range calls {
+				err := c.call()
+				if !errors.Is(err, tt.err) {
+					t.Errorf("%s() error = %v, does not wrap %v", c.name, err, tt.err)
+				}
+				if kind := Kind(err); kind != tt.wantKind {
+					t.Errorf("%s() error kind = %v, want %v", c.name, kind, tt.wantKind)
+				}
+			}
+		})
+	}
+}
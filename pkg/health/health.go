@@ -0,0 +1,164 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Check reports an error when a dependency is not usable.
+type Check func(ctx context.Context) error
+
+// Handler serves /healthz and /readyz. Liveness only reports that the process
+// serves requests, readiness runs the checks and fails once shutdown started.
+type Handler struct {
+	mux          *http.ServeMux
+	checks       map[string]Check
+	reporting    map[string]bool
+	timeout      time.Duration
+	mu           sync.RWMutex
+	shuttingDown bool
+}
+
+// NewHandler returns the probe handler, every readiness check gets timeout.
+func NewHandler(timeout time.Duration) *Handler {
+	h := &Handler{
+		mux:       http.NewServeMux(),
+		checks:    make(map[string]Check),
+		reporting: make(map[string]bool),
+		timeout:   timeout,
+	}
+	h.mux.HandleFunc("GET /healthz", h.healthz)
+	h.mux.HandleFunc("GET /readyz", h.readyz)
+	return h
+}
+
+// AddReadinessCheck registers a check of /readyz.
+func (h *Handler) AddReadinessCheck(name string, check Check) {
+	h.checks[name] = check
+}
+
+// AddReportingCheck registers a check which is listed by /readyz but does not
+// fail it, for dependencies the replica keeps serving without.
+func (h *Handler) AddReportingCheck(name string, check Check) {
+	h.checks[name] = check
+	h.reporting[name] = true
+}
+
+// ShutDown makes /readyz fail, so no new admissions are routed to the replica.
+func (h *Handler) ShutDown() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.shuttingDown = true
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+func (h *Handler) healthz(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintln(w, "ok")
+}
+
+func (h *Handler) readyz(w http.ResponseWriter, r *http.Request) {
+	h.mu.RLock()
+	shuttingDown := h.shuttingDown
+	h.mu.RUnlock()
+
+	var results map[string]error
+	if shuttingDown {
+		results = map[string]error{"shutdown": fmt.Errorf("shutting down")}
+	} else {
+		ctx, cancel := context.WithTimeout(r.Context(), h.timeout)
+		defer cancel()
+		results = h.runChecks(ctx)
+	}
+
+	names := make([]string, 0, len(results))
+	failed := false
+	for name, err := range results {
+		names = append(names, name)
+		failed = failed || (err != nil && !h.reporting[name])
+	}
+	sort.Strings(names)
+
+	var body strings.Builder
+	for _, name := range names {
+		err := results[name]
+		switch {
+		case err != nil && h.reporting[name]:
+			fmt.Fprintf(&body, "[!]%s degraded: %v\n", name, err)
+		case err != nil:
+			fmt.Fprintf(&body, "[-]%s failed: %v\n", name, err)
+		default:
+			fmt.Fprintf(&body, "[+]%s ok\n", name)
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if failed {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	fmt.Fprint(w, body.String())
+}
+
+// runChecks runs the checks concurrently, a slow backend does not delay the
+// others. Checks still running when ctx expires are reported as timed out.
+func (h *Handler) runChecks(ctx context.Context) map[string]error {
+	type result struct {
+		name string
+		err  error
+	}
+	resultC := make(chan result, len(h.checks))
+	for name, check := range h.checks {
+		go func(name string, check Check) {
+			resultC <- result{name: name, err: check(ctx)}
+		}(name, check)
+	}
+
+	results := make(map[string]error, len(h.checks))
+	for len(results) < len(h.checks) {
+		select {
+		case res := <-resultC:
+			results[res.name] = res.err
+		case <-ctx.Done():
+			for name := range h.checks {
+				if _, ok := results[name]; !ok {
+					results[name] = ctx.Err()
+				}
+			}
+		}
+	}
+	return results
+}
+
+// Result keeps the outcome of a check which runs in the background, e.g. a
+// periodic probe, so /readyz reports it without calling the dependency again.
+type Result struct {
+	mu  sync.RWMutex
+	err error
+}
+
+// NewResult returns a Result reporting err until the first Set.
+func NewResult(err error) *Result {
+	return &Result{err: err}
+}
+
+// Set records the outcome of the last run.
+func (r *Result) Set(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.err = err
+}
+
+// Check returns the outcome of the last run.
+func (r *Result) Check(_ context.Context) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.err
+}
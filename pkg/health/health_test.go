@@ -0,0 +1,92 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadyz(t *testing.T) {
+	errDown := errors.New("down")
+	ok := func(context.Context) error { return nil }
+	failing := func(context.Context) error { return errDown }
+
+	tests := []struct {
+		name       string
+		readiness  map[string]Check
+		reporting  map[string]Check
+		shutDown   bool
+		wantStatus int
+		wantLines  []string
+	}{
+		{
+			name:       "all ok",
+			readiness:  map[string]Check{"apiserver": ok},
+			reporting:  map[string]Check{"cache-backend": ok},
+			wantStatus: http.StatusOK,
+			wantLines:  []string{"[+]apiserver ok", "[+]cache-backend ok"},
+		},
+		{
+			name:       "readiness check fails",
+			readiness:  map[string]Check{"apiserver": failing},
+			reporting:  map[string]Check{"cache-backend": ok},
+			wantStatus: http.StatusServiceUnavailable,
+			wantLines:  []string{"[-]apiserver failed: down", "[+]cache-backend ok"},
+		},
+		{
+			name:       "reporting check fails",
+			readiness:  map[string]Check{"apiserver": ok},
+			reporting:  map[string]Check{"cache-backend": failing},
+			wantStatus: http.StatusOK,
+			wantLines:  []string{"[+]apiserver ok", "[!]cache-backend degraded: down"},
+		},
+		{
+			name:       "shutting down",
+			readiness:  map[string]Check{"apiserver": ok},
+			shutDown:   true,
+			wantStatus: http.StatusServiceUnavailable,
+			wantLines:  []string{"[-]shutdown failed: shutting down"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHandler(time.Second)
+			for name, check := range tt.readiness {
+				h.AddReadinessCheck(name, check)
+			}
+			for name, check := range tt.reporting {
+				h.AddReportingCheck(name, check)
+			}
+			if tt.shutDown {
+				h.ShutDown()
+			}
+
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n")
+			if strings.Join(lines, "|") != strings.Join(tt.wantLines, "|") {
+				t.Errorf("body = %q, want %q", lines, tt.wantLines)
+			}
+		})
+	}
+}
+
+func TestResult(t *testing.T) {
+	errInitial := errors.New("not probed yet")
+	result := NewResult(errInitial)
+	if err := result.Check(context.Background()); !errors.Is(err, errInitial) {
+		t.Errorf("Check() = %v, want %v", err, errInitial)
+	}
+	result.Set(nil)
+	if err := result.Check(context.Background()); err != nil {
+		t.Errorf("Check() = %v, want nil", err)
+	}
+}
@@ -1,6 +1,7 @@
 package k8s
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -18,9 +19,37 @@ func PrepareInClusterK8SClient() (*rest.Config, error) {
 	return config, nil
 }
 
-// PrepareLocalKubeconfigK8SClient initializes a Kubernetes client for use with a local kubeconfig file
-func PrepareLocalKubeconfigK8SClient() (*rest.Config, error) {
-	config, err := clientcmd.BuildConfigFromFlags("", filepath.Join(homeDir(), ".kube", "config"))
+// PrepareLocalKubeconfigK8SClient initializes a Kubernetes client for use with a kubeconfig file.
+// When kubeconfigPath is empty the default ~/.kube/config is used.
+func PrepareLocalKubeconfigK8SClient(kubeconfigPath string) (*rest.Config, error) {
+	if kubeconfigPath == "" {
+		kubeconfigPath = filepath.Join(homeDir(), ".kube", "config")
+	}
+	config, err := clientcmd.BuildConfigFromFlags("", kubeconfigPath)
+	if err != nil {
+		return nil, fmt.Errorf("error creating kubeconfig: %w", err)
+	}
+	return config, nil
+}
+
+// PrepareK8SClient initializes a Kubernetes client from a kubeconfig file and context.
+// When both are empty the in-cluster config is used, outside of a cluster the
+// kubeconfig is loaded from KUBECONFIG or ~/.kube/config instead.
+func PrepareK8SClient(kubeconfigPath, kubeContext string) (*rest.Config, error) {
+	if kubeconfigPath == "" && kubeContext == "" {
+		config, err := rest.InClusterConfig()
+		if err == nil {
+			return config, nil
+		}
+		if !errors.Is(err, rest.ErrNotInCluster) {
+			return nil, fmt.Errorf("error creating in-cluster config: %w", err)
+		}
+	}
+
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = kubeconfigPath
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: kubeContext}
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, overrides).ClientConfig()
 	if err != nil {
 		return nil, fmt.Errorf("error creating kubeconfig: %w", err)
 	}
@@ -0,0 +1,107 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jetstack/cert-manager/pkg/client/clientset/versioned"
+	cminformers "github.com/jetstack/cert-manager/pkg/client/informers/externalversions"
+	cmlisters "github.com/jetstack/cert-manager/pkg/client/listers/certmanager/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	networkinglisters "k8s.io/client-go/listers/networking/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Informers are the shared informers of the process. The webhooks and the cache
+// jobs read Ingresses, cert-manager Certificates, TLS Secrets and Namespaces from their
+// listers instead of the API server. Objects returned by the listers are shared
+// with the informer cache and must not be modified.
+type Informers struct {
+	Kube        informers.SharedInformerFactory
+	CertManager cminformers.SharedInformerFactory
+
+	Ingresses    networkinglisters.IngressLister
+	Certificates cmlisters.CertificateLister
+	TLSSecrets   corelisters.SecretLister
+	Namespaces   corelisters.NamespaceLister
+
+	secrets informers.SharedInformerFactory
+	synced  []cache.InformerSynced
+}
+
+// NewInformers registers the Ingress, Certificate, TLS Secret and Namespace informers. They
+// are started by Run, informers of other kinds requested from the factories
+// before Run are started with them.
+func NewInformers(kubeClient kubernetes.Interface, certManagerClient versioned.Interface, resync time.Duration) *Informers {
+	kubeInformers := informers.NewSharedInformerFactory(kubeClient, resync)
+	cmInformers := cminformers.NewSharedInformerFactory(certManagerClient, resync)
+	// Only TLS Secrets are watched, the other Secrets of the cluster are not needed
+	secretInformers := informers.NewSharedInformerFactoryWithOptions(kubeClient, resync,
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.FieldSelector = fields.OneTermEqualSelector("type", string(corev1.SecretTypeTLS)).String()
+		}))
+
+	ingressInformer := kubeInformers.Networking().V1().Ingresses()
+	certificateInformer := cmInformers.Certmanager().V1().Certificates()
+	secretInformer := secretInformers.Core().V1().Secrets()
+	namespaceInformer := kubeInformers.Core().V1().Namespaces()
+
+	return &Informers{
+		Kube:         kubeInformers,
+		CertManager:  cmInformers,
+		Ingresses:    ingressInformer.Lister(),
+		Certificates: certificateInformer.Lister(),
+		TLSSecrets:   secretInformer.Lister(),
+		Namespaces:   namespaceInformer.Lister(),
+		secrets:      secretInformers,
+		synced: []cache.InformerSynced{
+			ingressInformer.Informer().HasSynced,
+			certificateInformer.Informer().HasSynced,
+			secretInformer.Informer().HasSynced,
+			namespaceInformer.Informer().HasSynced,
+		},
+	}
+}
+
+// Run starts the informers and blocks until ctx is cancelled.
+func (i *Informers) Run(ctx context.Context) error {
+	i.Kube.Start(ctx.Done())
+	i.CertManager.Start(ctx.Done())
+	i.secrets.Start(ctx.Done())
+	<-ctx.Done()
+	i.Kube.Shutdown()
+	i.secrets.Shutdown()
+	return nil
+}
+
+// HasSynced reports whether the informers listed every object once.
+func (i *Informers) HasSynced() bool {
+	for _, synced := range i.synced {
+		if !synced() {
+			return false
+		}
+	}
+	return true
+}
+
+// WaitForCacheSync blocks until the informers are synced or ctx is cancelled.
+func (i *Informers) WaitForCacheSync(ctx context.Context) error {
+	if !cache.WaitForCacheSync(ctx.Done(), i.synced...) {
+		return fmt.Errorf("failed to wait for informer caches to sync")
+	}
+	return nil
+}
+
+// Ready is a readiness check, the listers answer lookups only once they are synced.
+func (i *Informers) Ready(_ context.Context) error {
+	if !i.HasSynced() {
+		return fmt.Errorf("informer caches are not synced")
+	}
+	return nil
+}
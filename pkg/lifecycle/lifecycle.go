@@ -0,0 +1,101 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	kwhlog "github.com/slok/kubewebhook/v2/pkg/log"
+)
+
+// Runnable runs until ctx is cancelled and returns once it is stopped.
+type Runnable func(ctx context.Context) error
+
+type component struct {
+	name string
+	run  Runnable
+}
+
+// Manager runs the components of the process. When the context is cancelled or
+// one component fails, every component is stopped and Run waits for all of them.
+type Manager struct {
+	logger     kwhlog.Logger
+	components []component
+}
+
+func New(logger kwhlog.Logger) *Manager {
+	return &Manager{logger: logger}
+}
+
+// Add registers a component, it is started by Run.
+func (lm *Manager) Add(name string, run Runnable) {
+	lm.components = append(lm.components, component{name: name, run: run})
+}
+
+// Run starts the components and blocks until all of them are stopped. It returns
+// the errors of the failed components.
+func (lm *Manager) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+	for _, c := range lm.components {
+		wg.Add(1)
+		go func(c component) {
+			defer wg.Done()
+			err := c.run(ctx)
+			if err != nil {
+				lm.logger.Errorf("%s failed: %v", c.name, err)
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("%s failed: %w", c.name, err))
+				mu.Unlock()
+			} else {
+				lm.logger.Infof("%s stopped", c.name)
+			}
+			// Stop the other components, the process cannot work without one of them
+			cancel()
+		}(c)
+	}
+
+	<-ctx.Done()
+	lm.logger.Infof("stopping everything...")
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// HTTPServer returns a Runnable serving with listen, e.g. server.ListenAndServe.
+// On cancellation the server stops accepting connections and in-flight requests
+// get drainTimeout to finish.
+func HTTPServer(server *http.Server, listen func() error, drainTimeout time.Duration) Runnable {
+	return func(ctx context.Context) error {
+		errC := make(chan error, 1)
+		go func() {
+			errC <- listen()
+		}()
+
+		select {
+		case err := <-errC:
+			return err
+		case <-ctx.Done():
+		}
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+		defer cancel()
+		err := server.Shutdown(shutdownCtx)
+		if err != nil {
+			return fmt.Errorf("failed to drain connections: %w", err)
+		}
+		err = <-errC
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+		return err
+	}
+}
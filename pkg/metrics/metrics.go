@@ -0,0 +1,274 @@
+package metrics
+
+import (
+	"time"
+
+	"dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/certstore"
+	"dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/resilience"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const namespace = "certcache"
+
+// Serving certificate reload results.
+const (
+	ReloadSuccess = "success"
+	ReloadError   = "error"
+)
+
+// Lookup results.
+const (
+	LookupHit  = "hit"
+	LookupMiss = "miss"
+)
+
+// CachedEntry is the expiry of the cached certificate of a TLS secret.
+type CachedEntry struct {
+	Namespace  string
+	SecretName string
+	NotAfter   time.Time
+}
+
+// Recorder records the certificate cache metrics. A nil Recorder records nothing,
+// so components can be used without metrics.
+type Recorder struct {
+	lookups         *prometheus.CounterVec
+	stored          prometheus.Counter
+	evicted         prometheus.Counter
+	purged          prometheus.Counter
+	notAfter        *prometheus.GaugeVec
+	entries         *prometheus.GaugeVec
+	backendDuration *prometheus.HistogramVec
+	backendErrors   *prometheus.CounterVec
+	backendRetries  *prometheus.CounterVec
+	backendCircuit  *prometheus.GaugeVec
+	backendUp       *prometheus.GaugeVec
+	jobDuration     *prometheus.HistogramVec
+	jobLastSuccess  *prometheus.GaugeVec
+	servingNotAfter prometheus.Gauge
+	servingReloads  *prometheus.CounterVec
+}
+
+func NewRecorder(reg prometheus.Registerer) (*Recorder, error) {
+	r := &Recorder{
+		lookups: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "lookups_total",
+			Help:      "Cache lookups of the webhooks by result.",
+		}, []string{"webhook", "result"}),
+		stored: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "certificates_stored_total",
+			Help:      "Certificates stored in the cache backend.",
+		}),
+		evicted: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "certificates_evicted_total",
+			Help:      "Certificates evicted from the cache backend.",
+		}),
+		purged: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "certificates_purged_total",
+			Help:      "Deleted certificates purged from the cache backend.",
+		}),
+		notAfter: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "certificate_not_after_timestamp_seconds",
+			Help:      "Expiry of the cached certificate of a TLS secret.",
+		}, []string{"namespace", "secret"}),
+		entries: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "entries",
+			Help:      "CertificateCache resources by phase.",
+		}, []string{"phase"}),
+		backendDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "backend_request_duration_seconds",
+			Help:      "Latency of the cache backend calls by operation.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"backend", "operation"}),
+		backendErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "backend_errors_total",
+			Help:      "Failed cache backend calls by operation and kind of error.",
+		}, []string{"backend", "operation", "kind"}),
+		backendRetries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "backend_retries_total",
+			Help:      "Retried cache backend calls by reason (throttled, unavailable).",
+		}, []string{"backend", "reason"}),
+		backendCircuit: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "backend_circuit_state",
+			Help:      "State of the cache backend circuit breaker (0 closed, 1 half-open, 2 open).",
+		}, []string{"backend"}),
+		backendUp: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "backend_up",
+			Help:      "Whether the cache backend answered the last probe (1) or not (0).",
+		}, []string{"backend"}),
+		jobDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "job_duration_seconds",
+			Help:      "Duration of the cache cron jobs.",
+			Buckets:   []float64{0.1, 0.5, 1, 5, 10, 30, 60, 300},
+		}, []string{"job"}),
+		jobLastSuccess: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "job_last_success_timestamp_seconds",
+			Help:      "Time the cache cron job last finished without error.",
+		}, []string{"job"}),
+		servingNotAfter: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "serving_certificate_not_after_timestamp_seconds",
+			Help:      "Expiry of the certificate served by the webhook server.",
+		}),
+		servingReloads: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "serving_certificate_reloads_total",
+			Help:      "Loads of the webhook serving certificate by result.",
+		}, []string{"result"}),
+	}
+
+	for _, c := range []prometheus.Collector{
+		r.lookups, r.stored, r.evicted, r.purged, r.notAfter, r.entries,
+		r.backendDuration, r.backendErrors, r.backendRetries, r.backendCircuit, r.backendUp, r.jobDuration, r.jobLastSuccess,
+		r.servingNotAfter, r.servingReloads,
+	} {
+		err := reg.Register(c)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// Lookup records a cache lookup of a webhook.
+func (r *Recorder) Lookup(webhook string, hit bool) {
+	if r == nil {
+		return
+	}
+	result := LookupMiss
+	if hit {
+		result = LookupHit
+	}
+	r.lookups.WithLabelValues(webhook, result).Inc()
+}
+
+func (r *Recorder) CertificateStored(namespace, secretName string, notAfter time.Time) {
+	if r == nil {
+		return
+	}
+	r.stored.Inc()
+	r.notAfter.WithLabelValues(namespace, secretName).Set(float64(notAfter.Unix()))
+}
+
+func (r *Recorder) CertificateEvicted(namespace, secretName string) {
+	if r == nil {
+		return
+	}
+	r.evicted.Inc()
+	r.notAfter.DeleteLabelValues(namespace, secretName)
+}
+
+func (r *Recorder) CertificatePurged() {
+	if r == nil {
+		return
+	}
+	r.purged.Inc()
+}
+
+// SetEntries replaces the per phase entry counts and the expiry of every cached certificate.
+func (r *Recorder) SetEntries(phases map[string]int, cached []CachedEntry) {
+	if r == nil {
+		return
+	}
+	r.entries.Reset()
+	for phase, count := range phases {
+		r.entries.WithLabelValues(phase).Set(float64(count))
+	}
+	r.notAfter.Reset()
+	for _, entry := range cached {
+		r.notAfter.WithLabelValues(entry.Namespace, entry.SecretName).Set(float64(entry.NotAfter.Unix()))
+	}
+}
+
+// ClearEntries removes the entry counts and expiries, e.g. once leadership is
+// lost, so only the leader exports them.
+func (r *Recorder) ClearEntries() {
+	if r == nil {
+		return
+	}
+	r.entries.Reset()
+	r.notAfter.Reset()
+}
+
+// ObserveBackendRequest records the latency and outcome of a cache backend call.
+func (r *Recorder) ObserveBackendRequest(backend, operation string, duration time.Duration, err error) {
+	if r == nil {
+		return
+	}
+	r.backendDuration.WithLabelValues(backend, operation).Observe(duration.Seconds())
+	if err != nil {
+		r.backendErrors.WithLabelValues(backend, operation, certstore.KindName(err)).Inc()
+	}
+}
+
+// BackendRetry records a retried cache backend call.
+func (r *Recorder) BackendRetry(backend, reason string) {
+	if r == nil {
+		return
+	}
+	r.backendRetries.WithLabelValues(backend, reason).Inc()
+}
+
+// BackendCircuitState records a state change of the cache backend circuit breaker.
+func (r *Recorder) BackendCircuitState(backend string, state resilience.State) {
+	if r == nil {
+		return
+	}
+	r.backendCircuit.WithLabelValues(backend).Set(float64(state))
+}
+
+// BackendUp records the result of a cache backend probe.
+func (r *Recorder) BackendUp(backend string, up bool) {
+	if r == nil {
+		return
+	}
+	value := 0.0
+	if up {
+		value = 1
+	}
+	r.backendUp.WithLabelValues(backend).Set(value)
+}
+
+// RunJob runs a cron job and records its duration and the time of the last success.
+func (r *Recorder) RunJob(job string, fn func() error) error {
+	start := time.Now()
+	err := fn()
+	if r == nil {
+		return err
+	}
+	r.jobDuration.WithLabelValues(job).Observe(time.Since(start).Seconds())
+	if err == nil {
+		r.jobLastSuccess.WithLabelValues(job).SetToCurrentTime()
+	}
+	return err
+}
+
+// ServingCertificateLoaded records a successful load of the webhook serving certificate.
+func (r *Recorder) ServingCertificateLoaded(notAfter time.Time) {
+	if r == nil {
+		return
+	}
+	r.servingReloads.WithLabelValues(ReloadSuccess).Inc()
+	r.servingNotAfter.Set(float64(notAfter.Unix()))
+}
+
+// ServingCertificateReloadFailed records a failed reload, the previous certificate is kept.
+func (r *Recorder) ServingCertificateReloadFailed() {
+	if r == nil {
+		return
+	}
+	r.servingReloads.WithLabelValues(ReloadError).Inc()
+}
@@ -0,0 +1,109 @@
+package plan
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	kwhlog "github.com/slok/kubewebhook/v2/pkg/log"
+)
+
+// Operations recorded in a plan.
+const (
+	OperationStoreSecret  = "store-secret"
+	OperationDeleteSecret = "delete-secret"
+	OperationPurgeSecret  = "purge-secret"
+	OperationUpdateStatus = "update-cache-status"
+	OperationUpdate       = "update"
+	OperationCreateSecret = "create-secret"
+	OperationMutate       = "mutate"
+)
+
+// Action is a write which was skipped in dry-run mode. Time and Details are
+// those of the last time it was planned, Count how often it was planned.
+type Action struct {
+	Time      time.Time `json:"time"`
+	Component string    `json:"component"`
+	Operation string    `json:"operation"`
+	Target    string    `json:"target"`
+	Details   string    `json:"details,omitempty"`
+	Count     int       `json:"count"`
+}
+
+// actionKey identifies an action, nothing is written in dry-run mode so serve
+// plans the same actions again on every job run and informer event.
+type actionKey struct {
+	component, operation, target string
+}
+
+// Plan collects the actions skipped in dry-run mode. A nil Plan means dry-run is
+// disabled, so components check Enabled before writing.
+type Plan struct {
+	mu      sync.Mutex
+	actions []Action
+	index   map[actionKey]int
+	logger  kwhlog.Logger
+}
+
+func New(logger kwhlog.Logger) *Plan {
+	return &Plan{index: make(map[actionKey]int), logger: logger}
+}
+
+// Enabled reports whether writes have to be recorded instead of executed.
+func (p *Plan) Enabled() bool {
+	return p != nil
+}
+
+// Record logs and collects an action instead of executing it. An action planned
+// before is updated instead of added again, so the plan stays bounded.
+func (p *Plan) Record(component, operation, target, details string) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	key := actionKey{component: component, operation: operation, target: target}
+	if i, ok := p.index[key]; ok {
+		p.logger.Debugf(" -- DRY-RUN -- %s would %s %s %s", component, operation, target, details)
+		p.actions[i].Time = time.Now()
+		p.actions[i].Details = details
+		p.actions[i].Count++
+		return
+	}
+	p.logger.Infof(" -- DRY-RUN -- %s would %s %s %s", component, operation, target, details)
+	p.index[key] = len(p.actions)
+	p.actions = append(p.actions, Action{
+		Time:      time.Now(),
+		Component: component,
+		Operation: operation,
+		Target:    target,
+		Details:   details,
+		Count:     1,
+	})
+}
+
+// Actions returns a copy of the recorded actions.
+func (p *Plan) Actions() []Action {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]Action{}, p.actions...)
+}
+
+// WriteJSON writes the plan as a JSON report.
+func (p *Plan) WriteJSON(w io.Writer) error {
+	actions := p.Actions()
+	if actions == nil {
+		actions = []Action{}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(struct {
+		DryRun  bool     `json:"dryRun"`
+		Actions []Action `json:"actions"`
+	}{DryRun: p.Enabled(), Actions: actions})
+}
@@ -0,0 +1,162 @@
+package replay
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/apis/certcache/v1alpha1"
+	"dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/certstore"
+	cmfake "github.com/jetstack/cert-manager/pkg/client/clientset/versioned/fake"
+	cmscheme "github.com/jetstack/cert-manager/pkg/client/clientset/versioned/scheme"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	k8stesting "k8s.io/client-go/testing"
+	"sigs.k8s.io/yaml"
+)
+
+const certManagerGroup = "cert-manager.io"
+
+// Fixtures are the objects and cache entries the webhooks look up while replaying.
+type Fixtures struct {
+	// Objects are Kubernetes objects, e.g. Namespaces, Ingresses, Secrets,
+	// cert-manager Certificates and CertificateCaches.
+	Objects []runtime.RawExtension `json:"objects"`
+	// Cache are the entries of the cache backend.
+	Cache []CacheEntry `json:"cache"`
+}
+
+// CacheEntry is a cached certificate with its key, PEM encoded.
+type CacheEntry struct {
+	Key  string `json:"key"`
+	Cert string `json:"cert"`
+	// PrivateKey defaults to an empty key, the webhooks only read the certificate.
+	PrivateKey string `json:"privateKey,omitempty"`
+	// Deleted marks the entry as soft deleted and pending purge.
+	Deleted bool `json:"deleted,omitempty"`
+}
+
+// LoadFixtures reads and merges YAML or JSON fixture files.
+func LoadFixtures(paths ...string) (*Fixtures, error) {
+	fixtures := &Fixtures{}
+	for _, path := range paths {
+		data, err := os.ReadFile(filepath.Clean(path))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read fixtures: %w", err)
+		}
+		var f Fixtures
+		err = yaml.Unmarshal(data, &f)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse fixtures %s: %w", path, err)
+		}
+		fixtures.Objects = append(fixtures.Objects, f.Objects...)
+		fixtures.Cache = append(fixtures.Cache, f.Cache...)
+	}
+	return fixtures, nil
+}
+
+// Clients are fake clients serving the fixtures. Writes of the webhooks go to
+// the fakes, so later reviews see them.
+type Clients struct {
+	KubeClient  *kubefake.Clientset
+	CertManager *cmfake.Clientset
+	Dynamic     *dynamicfake.FakeDynamicClient
+	CertStore   *certstore.MemoryStore
+}
+
+// NewClients builds fake clients seeded with the fixtures.
+func (f *Fixtures) NewClients() (*Clients, error) {
+	var kubeObjects, certManagerObjects, dynamicObjects []runtime.Object
+	for i, raw := range f.Objects {
+		u := &unstructured.Unstructured{}
+		err := json.Unmarshal(raw.Raw, &u.Object)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse fixture object %d: %w", i, err)
+		}
+
+		gvk := u.GroupVersionKind()
+		switch gvk.Group {
+		case v1alpha1.GroupName:
+			dynamicObjects = append(dynamicObjects, u)
+		case certManagerGroup:
+			obj, _, err := cmscheme.Codecs.UniversalDeserializer().Decode(raw.Raw, nil, nil)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode fixture %s %s: %w", gvk.Kind, u.GetName(), err)
+			}
+			certManagerObjects = append(certManagerObjects, obj)
+		default:
+			obj, _, err := clientgoscheme.Codecs.UniversalDeserializer().Decode(raw.Raw, nil, nil)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode fixture %s %s: %w", gvk.Kind, u.GetName(), err)
+			}
+			kubeObjects = append(kubeObjects, obj)
+		}
+	}
+
+	certStore := certstore.NewMemoryStore()
+	for _, entry := range f.Cache {
+		err := certStore.StoreSecret(context.Background(), entry.Key, []byte(entry.Cert), []byte(entry.PrivateKey))
+		if err != nil {
+			return nil, err
+		}
+		if entry.Deleted {
+			err = certStore.DeleteSecret(context.Background(), entry.Key)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	listKinds := map[schema.GroupVersionResource]string{v1alpha1.CertificateCacheResource: "CertificateCacheList"}
+	return &Clients{
+		KubeClient:  kubefake.NewSimpleClientset(kubeObjects...),
+		CertManager: cmfake.NewSimpleClientset(certManagerObjects...),
+		Dynamic:     dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), listKinds, dynamicObjects...),
+		CertStore:   certStore,
+	}, nil
+}
+
+// Writes returns the writes to the fake clients since the last call, e.g.
+// "create secrets shop/shop-tls".
+func (c *Clients) Writes() []string {
+	var writes []string
+	for _, fake := range []*k8stesting.Fake{&c.KubeClient.Fake, &c.CertManager.Fake, &c.Dynamic.Fake} {
+		for _, action := range fake.Actions() {
+			switch action.GetVerb() {
+			case "create", "update", "patch", "delete":
+			default:
+				continue
+			}
+			resource := action.GetResource().Resource
+			if action.GetSubresource() != "" {
+				resource += "/" + action.GetSubresource()
+			}
+			writes = append(writes, fmt.Sprintf("%s %s %s/%s", action.GetVerb(), resource, action.GetNamespace(), actionName(action)))
+		}
+		fake.ClearActions()
+	}
+	return writes
+}
+
+func actionName(action k8stesting.Action) string {
+	switch a := action.(type) {
+	case k8stesting.CreateAction:
+		// Update actions carry the object as well
+		accessor, err := meta.Accessor(a.GetObject())
+		if err == nil {
+			return accessor.GetName()
+		}
+	case k8stesting.PatchAction:
+		return a.GetName()
+	case k8stesting.DeleteAction:
+		return a.GetName()
+	}
+	return ""
+}
@@ -0,0 +1,132 @@
+package replay
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	kwhmodel "github.com/slok/kubewebhook/v2/pkg/model"
+	kwhwebhook "github.com/slok/kubewebhook/v2/pkg/webhook"
+	admissionv1 "k8s.io/api/admission/v1"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// Webhook names, matching the last element of the webhook paths.
+const (
+	WebhookCertOrder        = "certorder"
+	WebhookIngressCerts     = "ingresscerts"
+	WebhookCertificateCache = "certificatecache"
+	WebhookDeployment       = "deployment"
+)
+
+// WebhookForKind returns the webhook admitting the kind, empty when none does.
+func WebhookForKind(kind string) string {
+	switch kind {
+	case "Challenge":
+		return WebhookCertOrder
+	case "Ingress":
+		return WebhookIngressCerts
+	case "Certificate":
+		return WebhookCertificateCache
+	case "Deployment":
+		return WebhookDeployment
+	}
+	return ""
+}
+
+// LoadReview reads an admission.k8s.io/v1 or v1beta1 AdmissionReview from a YAML or JSON file.
+func LoadReview(path string) (kwhmodel.AdmissionReview, error) {
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return kwhmodel.AdmissionReview{}, fmt.Errorf("failed to read admission review: %w", err)
+	}
+	data, err = yaml.YAMLToJSON(data)
+	if err != nil {
+		return kwhmodel.AdmissionReview{}, fmt.Errorf("failed to parse admission review %s: %w", path, err)
+	}
+
+	var typeMeta metav1.TypeMeta
+	err = json.Unmarshal(data, &typeMeta)
+	if err != nil {
+		return kwhmodel.AdmissionReview{}, fmt.Errorf("failed to parse admission review %s: %w", path, err)
+	}
+
+	switch typeMeta.APIVersion {
+	case admissionv1.SchemeGroupVersion.String():
+		ar := &admissionv1.AdmissionReview{}
+		err = json.Unmarshal(data, ar)
+		if err != nil {
+			return kwhmodel.AdmissionReview{}, fmt.Errorf("failed to parse admission review %s: %w", path, err)
+		}
+		if ar.Request == nil {
+			return kwhmodel.AdmissionReview{}, fmt.Errorf("admission review %s has no request", path)
+		}
+		return kwhmodel.NewAdmissionReviewV1(ar), nil
+	case admissionv1beta1.SchemeGroupVersion.String():
+		ar := &admissionv1beta1.AdmissionReview{}
+		err = json.Unmarshal(data, ar)
+		if err != nil {
+			return kwhmodel.AdmissionReview{}, fmt.Errorf("failed to parse admission review %s: %w", path, err)
+		}
+		if ar.Request == nil {
+			return kwhmodel.AdmissionReview{}, fmt.Errorf("admission review %s has no request", path)
+		}
+		return kwhmodel.NewAdmissionReviewV1Beta1(ar), nil
+	default:
+		return kwhmodel.AdmissionReview{}, fmt.Errorf("admission review %s has unsupported apiVersion %q", path, typeMeta.APIVersion)
+	}
+}
+
+// Result is the outcome of replaying an admission review.
+type Result struct {
+	File      string          `json:"file"`
+	Webhook   string          `json:"webhook"`
+	Operation string          `json:"operation"`
+	Kind      string          `json:"kind,omitempty"`
+	Namespace string          `json:"namespace,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Allowed   bool            `json:"allowed"`
+	Message   string          `json:"message,omitempty"`
+	Patch     json.RawMessage `json:"patch,omitempty"`
+	Warnings  []string        `json:"warnings,omitempty"`
+	Writes    []string        `json:"writes,omitempty"`
+	Error     string          `json:"error,omitempty"`
+}
+
+// Review runs the admission review through the webhook. Mutating webhooks always
+// allow, a failed review is reported in Error.
+func Review(ctx context.Context, name string, webhook kwhwebhook.Webhook, ar kwhmodel.AdmissionReview) Result {
+	result := Result{
+		Webhook:   name,
+		Operation: string(ar.Operation),
+		Namespace: ar.Namespace,
+		Name:      ar.Name,
+	}
+	if ar.RequestGVK != nil {
+		result.Kind = ar.RequestGVK.Kind
+	}
+
+	resp, err := webhook.Review(ctx, ar)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	switch r := resp.(type) {
+	case *kwhmodel.MutatingAdmissionResponse:
+		result.Allowed = true
+		result.Warnings = r.Warnings
+		if len(r.JSONPatchPatch) > 0 && string(r.JSONPatchPatch) != "[]" {
+			result.Patch = r.JSONPatchPatch
+		}
+	case *kwhmodel.ValidatingAdmissionResponse:
+		result.Allowed = r.Allowed
+		result.Message = r.Message
+		result.Warnings = r.Warnings
+	}
+	return result
+}
@@ -0,0 +1,45 @@
+package resilience
+
+import (
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Backoff is an exponential backoff with jitter.
+type Backoff struct {
+	Initial    time.Duration
+	Max        time.Duration
+	MaxRetries int
+}
+
+// Delay returns the wait before the given retry, starting at 0. Half of the
+// exponential delay is random so clients throttled together do not retry together.
+func (b Backoff) Delay(retry int) time.Duration {
+	delay := b.Max
+	if retry < 32 {
+		delay = min(b.Initial<<retry, b.Max)
+	}
+	half := delay / 2
+	if half <= 0 {
+		return delay
+	}
+	return half + time.Duration(rand.Int63n(int64(half)))
+}
+
+// RetryAfter parses a Retry-After header given in seconds or as HTTP date. It
+// returns 0 when the header is missing or invalid.
+func RetryAfter(header http.Header) time.Duration {
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0)
+	}
+	return 0
+}
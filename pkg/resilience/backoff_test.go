@@ -0,0 +1,60 @@
+package resilience
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestBackoffDelay(t *testing.T) {
+	b := Backoff{Initial: 500 * time.Millisecond, Max: 10 * time.Second}
+
+	tests := []struct {
+		retry    int
+		min, max time.Duration
+	}{
+		{retry: 0, min: 250 * time.Millisecond, max: 500 * time.Millisecond},
+		{retry: 1, min: 500 * time.Millisecond, max: time.Second},
+		{retry: 3, min: 2 * time.Second, max: 4 * time.Second},
+		{retry: 5, min: 5 * time.Second, max: 10 * time.Second},
+		{retry: 40, min: 5 * time.Second, max: 10 * time.Second},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 100; i++ {
+			delay := b.Delay(tt.retry)
+			if delay < tt.min || delay >= tt.max {
+				t.Fatalf("Delay(%d) = %s, want in [%s, %s)", tt.retry, delay, tt.min, tt.max)
+			}
+		}
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   time.Duration
+	}{
+		{name: "missing"},
+		{name: "seconds", header: "7", want: 7 * time.Second},
+		{name: "zero seconds", header: "0"},
+		{name: "invalid", header: "soon"},
+		{name: "date in the past", header: "Mon, 01 Jan 2001 00:00:00 GMT"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			if tt.header != "" {
+				header.Set("Retry-After", tt.header)
+			}
+			if got := RetryAfter(header); got != tt.want {
+				t.Errorf("RetryAfter(%q) = %s, want %s", tt.header, got, tt.want)
+			}
+		})
+	}
+
+	future := time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)
+	if got := RetryAfter(http.Header{"Retry-After": []string{future}}); got <= 0 || got > time.Minute {
+		t.Errorf("RetryAfter(%q) = %s, want up to 1m", future, got)
+	}
+}
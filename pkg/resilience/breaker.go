@@ -0,0 +1,128 @@
+package resilience
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrOpen is returned for calls rejected while the circuit breaker is open.
+var ErrOpen = errors.New("circuit breaker is open")
+
+// State of a circuit breaker, the values are exported as metric.
+type State int
+
+const (
+	StateClosed State = iota
+	StateHalfOpen
+	StateOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateHalfOpen:
+		return "half-open"
+	case StateOpen:
+		return "open"
+	}
+	return "unknown"
+}
+
+// Breaker opens after failureThreshold consecutive failures and rejects calls
+// for cooldown. Then a single probe call is let through, its outcome closes the
+// breaker or opens it again.
+type Breaker struct {
+	failureThreshold int
+	cooldown         time.Duration
+	onChange         func(State)
+
+	mu       sync.Mutex
+	state    State
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// NewBreaker returns a closed breaker, onChange is called on every state change.
+func NewBreaker(failureThreshold int, cooldown time.Duration, onChange func(State)) *Breaker {
+	if onChange == nil {
+		onChange = func(State) {}
+	}
+	b := &Breaker{failureThreshold: failureThreshold, cooldown: cooldown, onChange: onChange}
+	onChange(StateClosed)
+	return b
+}
+
+// Allow reports whether a call may be made. Every allowed call has to be ended
+// with Success, Failure or Release.
+func (b *Breaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case StateOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return ErrOpen
+		}
+		b.setState(StateHalfOpen)
+		b.probing = true
+		return nil
+	case StateHalfOpen:
+		if b.probing {
+			return ErrOpen
+		}
+		b.probing = true
+		return nil
+	}
+	return nil
+}
+
+// Success records a call answered by the backend, also when the answer is an error
+// like not found.
+func (b *Breaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+	b.probing = false
+	if b.state != StateClosed {
+		b.setState(StateClosed)
+	}
+}
+
+// Failure records a call failed because the backend is unavailable or throttling.
+func (b *Breaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	b.probing = false
+	if b.state == StateHalfOpen || (b.state == StateClosed && b.failures >= b.failureThreshold) {
+		b.openedAt = time.Now()
+		b.setState(StateOpen)
+	}
+}
+
+// Release ends a call without an outcome, e.g. cancelled by the caller.
+func (b *Breaker) Release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+// State returns the current state.
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == StateOpen && time.Since(b.openedAt) >= b.cooldown {
+		return StateHalfOpen
+	}
+	return b.state
+}
+
+func (b *Breaker) setState(state State) {
+	b.state = state
+	b.onChange(state)
+}
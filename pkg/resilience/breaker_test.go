@@ -0,0 +1,119 @@
+package resilience
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	const cooldown = 20 * time.Millisecond
+
+	type step struct {
+		action    string // allow, success, failure, release or wait
+		wantErr   error
+		wantState State
+	}
+	tests := []struct {
+		name    string
+		steps   []step
+		changes []State
+	}{
+		{
+			name: "stays closed below the threshold",
+			steps: []step{
+				{action: "failure", wantState: StateClosed},
+				{action: "failure", wantState: StateClosed},
+				{action: "success", wantState: StateClosed},
+				{action: "failure", wantState: StateClosed},
+				{action: "failure", wantState: StateClosed},
+				{action: "allow", wantState: StateClosed},
+			},
+			changes: []State{StateClosed},
+		},
+		{
+			name: "opens at the threshold and rejects calls",
+			steps: []step{
+				{action: "failure", wantState: StateClosed},
+				{action: "failure", wantState: StateClosed},
+				{action: "failure", wantState: StateOpen},
+				{action: "allow", wantErr: ErrOpen, wantState: StateOpen},
+			},
+			changes: []State{StateClosed, StateOpen},
+		},
+		{
+			name: "probe success closes",
+			steps: []step{
+				{action: "failure", wantState: StateClosed},
+				{action: "failure", wantState: StateClosed},
+				{action: "failure", wantState: StateOpen},
+				{action: "wait", wantState: StateHalfOpen},
+				{action: "allow", wantState: StateHalfOpen},
+				{action: "allow", wantErr: ErrOpen, wantState: StateHalfOpen},
+				{action: "success", wantState: StateClosed},
+				{action: "allow", wantState: StateClosed},
+			},
+			changes: []State{StateClosed, StateOpen, StateHalfOpen, StateClosed},
+		},
+		{
+			name: "probe failure opens again",
+			steps: []step{
+				{action: "failure", wantState: StateClosed},
+				{action: "failure", wantState: StateClosed},
+				{action: "failure", wantState: StateOpen},
+				{action: "wait", wantState: StateHalfOpen},
+				{action: "allow", wantState: StateHalfOpen},
+				{action: "failure", wantState: StateOpen},
+				{action: "allow", wantErr: ErrOpen, wantState: StateOpen},
+			},
+			changes: []State{StateClosed, StateOpen, StateHalfOpen, StateOpen},
+		},
+		{
+			name: "released probe lets the next call probe",
+			steps: []step{
+				{action: "failure", wantState: StateClosed},
+				{action: "failure", wantState: StateClosed},
+				{action: "failure", wantState: StateOpen},
+				{action: "wait", wantState: StateHalfOpen},
+				{action: "allow", wantState: StateHalfOpen},
+				{action: "release", wantState: StateHalfOpen},
+				{action: "allow", wantState: StateHalfOpen},
+				{action: "success", wantState: StateClosed},
+			},
+			changes: []State{StateClosed, StateOpen, StateHalfOpen, StateClosed},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var changes []State
+			b := NewBreaker(3, cooldown, func(state State) { changes = append(changes, state) })
+
+			for i, s := range tt.steps {
+				var err error
+				switch s.action {
+				case "allow":
+					err = b.Allow()
+				case "success":
+					b.Success()
+				case "failure":
+					b.Failure()
+				case "release":
+					b.Release()
+				case "wait":
+					time.Sleep(cooldown)
+				}
+				if !errors.Is(err, s.wantErr) {
+					t.Errorf("step %d %s: error = %v, want %v", i, s.action, err, s.wantErr)
+				}
+				if got := b.State(); got != s.wantState {
+					t.Errorf("step %d %s: state = %s, want %s", i, s.action, got, s.wantState)
+				}
+			}
+			if !reflect.DeepEqual(changes, tt.changes) {
+				t.Errorf("state changes = %v, want %v", changes, tt.changes)
+			}
+		})
+	}
+}
@@ -0,0 +1,324 @@
+package s3wrapper
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/certstore"
+	"dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/utils"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// Object metadata keys, stored as x-amz-meta-* headers.
+const (
+	notAfterMetadata      = "Not-After"
+	sansMetadata          = "Sans"
+	sourceClusterMetadata = "Source-Cluster"
+)
+
+// S3Config configures the connection to an S3-compatible bucket.
+type S3Config struct {
+	// Endpoint of the S3 API without scheme, e.g. s3.amazonaws.com or localhost:9000.
+	Endpoint string
+	Bucket   string
+	// Prefix all cache entries are stored under, may be empty.
+	Prefix string
+	Region string
+	// Insecure disables TLS towards the endpoint.
+	Insecure bool
+	// EncryptionKeyFile holds a base64 encoded 32 byte AES-256 key.
+	EncryptionKeyFile string
+	// SourceCluster is recorded on every stored object.
+	SourceCluster string
+}
+
+// S3Client stores cache entries as client side encrypted objects in a versioned
+// bucket. Deleting an entry adds a delete marker, purging removes all versions,
+// which mirrors the Key Vault soft delete.
+type S3Client struct {
+	client        *minio.Client
+	aead          cipher.AEAD
+	bucket        string
+	prefix        string
+	sourceCluster string
+}
+
+var _ certstore.CertStore = (*S3Client)(nil)
+
+type objectPayload struct {
+	Cert []byte `json:"cert"`
+	Key  []byte `json:"key"`
+}
+
+func NewS3Client(ctx context.Context, cfg S3Config) (*S3Client, error) {
+	aead, err := loadEncryptionKey(cfg.EncryptionKeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	// Static credentials from the environment first, then the instance/pod identity.
+	creds := credentials.NewChainCredentials([]credentials.Provider{
+		&credentials.EnvAWS{},
+		&credentials.EnvMinio{},
+		&credentials.IAM{},
+	})
+	client, err := minio.New(cfg.Endpoint, &minio.Options{
+		Creds:  creds,
+		Secure: !cfg.Insecure,
+		Region: cfg.Region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create s3 client: %w", err)
+	}
+
+	versioning, err := client.GetBucketVersioning(ctx, cfg.Bucket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get versioning of bucket %s: %w", cfg.Bucket, err)
+	}
+	if !versioning.Enabled() {
+		return nil, fmt.Errorf("bucket %s must have versioning enabled", cfg.Bucket)
+	}
+
+	return &S3Client{
+		client:        client,
+		aead:          aead,
+		bucket:        cfg.Bucket,
+		prefix:        strings.Trim(cfg.Prefix, "/"),
+		sourceCluster: cfg.SourceCluster,
+	}, nil
+}
+
+func loadEncryptionKey(keyFile string) (cipher.AEAD, error) {
+	encoded, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read encryption key: %w", err)
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(encoded)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode encryption key: %w", err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("encryption key must be 32 bytes, got %d", len(key))
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+func (sc *S3Client) objectName(secretName string) string {
+	return path.Join(sc.prefix, secretName)
+}
+
+func (sc *S3Client) secretName(objectName string) string {
+	return strings.TrimPrefix(strings.TrimPrefix(objectName, sc.prefix), "/")
+}
+
+// encrypt seals the payload with AES-256-GCM. The object name is bound as
+// additional data so a ciphertext can not be swapped between entries.
+func (sc *S3Client) encrypt(objectName string, payload []byte) ([]byte, error) {
+	nonce := make([]byte, sc.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return sc.aead.Seal(nonce, nonce, payload, []byte(objectName)), nil
+}
+
+func (sc *S3Client) decrypt(objectName string, ciphertext []byte) ([]byte, error) {
+	if len(ciphertext) < sc.aead.NonceSize() {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+	nonce, sealed := ciphertext[:sc.aead.NonceSize()], ciphertext[sc.aead.NonceSize():]
+	return sc.aead.Open(nil, nonce, sealed, []byte(objectName))
+}
+
+func (sc *S3Client) StoreSecret(ctx context.Context, secretName string, cert, key []byte) error {
+	expiry, err := utils.GetFirstCertExpiryFromPEM(cert)
+	if err != nil {
+		return fmt.Errorf("failed to parse certificate: %w", err)
+	}
+	_, altNames, err := utils.GetFirstCertDetailsFromPEM(cert)
+	if err != nil {
+		return fmt.Errorf("failed to parse certificate: %w", err)
+	}
+
+	payload, err := json.Marshal(objectPayload{Cert: cert, Key: key})
+	if err != nil {
+		return fmt.Errorf("failed to encode secret: %w", err)
+	}
+	objectName := sc.objectName(secretName)
+	ciphertext, err := sc.encrypt(objectName, payload)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt secret: %w", err)
+	}
+
+	_, err = sc.client.PutObject(ctx, sc.bucket, objectName, bytes.NewReader(ciphertext), int64(len(ciphertext)), minio.PutObjectOptions{
+		ContentType: "application/octet-stream",
+		UserMetadata: map[string]string{
+			notAfterMetadata:      expiry.UTC().Format(time.RFC3339),
+			sansMetadata:          strings.Join(altNames, ","),
+			sourceClusterMetadata: sc.sourceCluster,
+		},
+	})
+	err = typedError(err)
+	if err != nil {
+		return fmt.Errorf("failed to store secret: %w", err)
+	}
+	return nil
+}
+
+func (sc *S3Client) GetSecret(ctx context.Context, secretName string) ([]byte, []byte, error) {
+	objectName := sc.objectName(secretName)
+	object, err := sc.client.GetObject(ctx, sc.bucket, objectName, minio.GetObjectOptions{})
+	err = typedError(err)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get secret: %w", err)
+	}
+	defer object.Close()
+
+	ciphertext, err := io.ReadAll(object)
+	err = typedError(err)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get secret: %w", err)
+	}
+	payload, err := sc.decrypt(objectName, ciphertext)
+	if err != nil {
+		return nil, nil, certstore.NewError(certstore.ErrCorrupt, fmt.Errorf("failed to decrypt secret: %w", err))
+	}
+
+	var decoded objectPayload
+	err = json.Unmarshal(payload, &decoded)
+	if err != nil {
+		return nil, nil, certstore.NewError(certstore.ErrCorrupt, fmt.Errorf("failed to decode secret: %w", err))
+	}
+	return decoded.Cert, decoded.Key, nil
+}
+
+// GetCertificateExpiry reads the expiry from the object metadata without downloading the object.
+func (sc *S3Client) GetCertificateExpiry(ctx context.Context, secretName string) (time.Time, error) {
+	info, err := sc.client.StatObject(ctx, sc.bucket, sc.objectName(secretName), minio.StatObjectOptions{})
+	err = typedError(err)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get secret: %w", err)
+	}
+
+	expiry, err := time.Parse(time.RFC3339, info.UserMetadata[notAfterMetadata])
+	if err != nil {
+		return time.Time{}, certstore.NewError(certstore.ErrCorrupt, fmt.Errorf("failed to parse %s metadata: %w", notAfterMetadata, err))
+	}
+	return expiry, nil
+}
+
+func (sc *S3Client) SecretExists(ctx context.Context, secretName string) (bool, error) {
+	_, err := sc.client.StatObject(ctx, sc.bucket, sc.objectName(secretName), minio.StatObjectOptions{})
+	err = typedError(err)
+	if err != nil {
+		if errors.Is(err, certstore.ErrNotFound) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to check secret in bucket: %w", err)
+	}
+	return true, nil
+}
+
+func (sc *S3Client) DeleteSecret(ctx context.Context, secretName string) error {
+	//Validate if exist
+	exists, err := sc.SecretExists(ctx, secretName)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return nil
+	}
+
+	//Add delete marker, previous versions are kept until purge
+	err = typedError(sc.client.RemoveObject(ctx, sc.bucket, sc.objectName(secretName), minio.RemoveObjectOptions{}))
+	if err != nil {
+		return fmt.Errorf("failed to delete secret: %w", err)
+	}
+	return nil
+}
+
+func (sc *S3Client) ListSecretsPendingPurge(ctx context.Context) ([]string, error) {
+	prefix := sc.prefix
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	var secretsPendingPurge []string
+	for object := range sc.client.ListObjects(ctx, sc.bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true, WithVersions: true}) {
+		if object.Err != nil {
+			return nil, fmt.Errorf("failed to list deleted secrets: %w", typedError(object.Err))
+		}
+		if object.IsLatest && object.IsDeleteMarker {
+			secretsPendingPurge = append(secretsPendingPurge, sc.secretName(object.Key))
+		}
+	}
+
+	sort.Strings(secretsPendingPurge)
+	return secretsPendingPurge, nil
+}
+
+func (sc *S3Client) PurgerDeletedSecret(ctx context.Context, secretName string) error {
+	objectName := sc.objectName(secretName)
+
+	var versions []minio.ObjectInfo
+	for object := range sc.client.ListObjects(ctx, sc.bucket, minio.ListObjectsOptions{Prefix: objectName, WithVersions: true}) {
+		if object.Err != nil {
+			return fmt.Errorf("failed to list secret versions: %w", typedError(object.Err))
+		}
+		if object.Key != objectName {
+			continue
+		}
+		// Stored again in the meantime, keep it.
+		if object.IsLatest && !object.IsDeleteMarker {
+			return fmt.Errorf("failed to purge secret: secret %s is not deleted", secretName)
+		}
+		versions = append(versions, object)
+	}
+
+	for _, version := range versions {
+		err := typedError(sc.client.RemoveObject(ctx, sc.bucket, objectName, minio.RemoveObjectOptions{VersionID: version.VersionID}))
+		if err != nil {
+			return fmt.Errorf("failed to purge secret: %w", err)
+		}
+	}
+	return nil
+}
+
+// typedError gives the error of an S3 call its certstore kind. Connection
+// failures are unavailable, a cancelled call has no kind.
+func typedError(err error) error {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return err
+	}
+	resp := minio.ToErrorResponse(err)
+	switch {
+	case resp.Code == "NoSuchKey" || resp.Code == "NoSuchVersion":
+		return certstore.NewError(certstore.ErrNotFound, err)
+	case resp.Code == "AccessDenied" || resp.Code == "InvalidAccessKeyId" || resp.Code == "SignatureDoesNotMatch":
+		return certstore.NewError(certstore.ErrForbidden, err)
+	case resp.Code == "SlowDown" || resp.StatusCode == http.StatusTooManyRequests:
+		return certstore.NewError(certstore.ErrThrottled, err)
+	case resp.Code == "" || resp.StatusCode >= http.StatusInternalServerError:
+		return certstore.NewError(certstore.ErrUnavailable, err)
+	}
+	return err
+}
@@ -0,0 +1,309 @@
+package s3wrapper
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/certstore"
+	"github.com/minio/minio-go/v7"
+)
+
+func writeEncryptionKey(t *testing.T, size int) string {
+	t.Helper()
+	key := make([]byte, size)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(t.TempDir(), "encryption.key")
+	err := os.WriteFile(keyFile, []byte(base64.StdEncoding.EncodeToString(key)+"\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keyFile
+}
+
+func testCertificate(t *testing.T, notAfter time.Time) ([]byte, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "shop.example.com"},
+		DNSNames:     []string{"shop.example.com", "www.shop.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func TestLoadEncryptionKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		keyFile func(t *testing.T) string
+		wantErr bool
+	}{
+		{name: "32 bytes", keyFile: func(t *testing.T) string { return writeEncryptionKey(t, 32) }},
+		{name: "16 bytes", keyFile: func(t *testing.T) string { return writeEncryptionKey(t, 16) }, wantErr: true},
+		{name: "missing", keyFile: func(t *testing.T) string { return filepath.Join(t.TempDir(), "missing") }, wantErr: true},
+		{name: "not base64", keyFile: func(t *testing.T) string {
+			keyFile := filepath.Join(t.TempDir(), "encryption.key")
+			if err := os.WriteFile(keyFile, []byte("not base64!"), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			return keyFile
+		}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadEncryptionKey(tt.keyFile(t))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("loadEncryptionKey() error = %v, want error %t", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	aead, err := loadEncryptionKey(writeEncryptionKey(t, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherAEAD, err := loadEncryptionKey(writeEncryptionKey(t, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sc := &S3Client{aead: aead}
+	payload := []byte(`{"cert":"c2hvcA==","key":"a2V5"}`)
+
+	ciphertext, err := sc.encrypt("certcache/shop-tls--shop", payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(ciphertext, payload) {
+		t.Fatal("ciphertext contains the plaintext")
+	}
+	again, err := sc.encrypt("certcache/shop-tls--shop", payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(ciphertext, again) {
+		t.Error("two encryptions of the same payload are equal, the nonce is reused")
+	}
+
+	tampered := append([]byte{}, ciphertext...)
+	tampered[len(tampered)-1] ^= 0xff
+
+	tests := []struct {
+		name       string
+		client     *S3Client
+		objectName string
+		ciphertext []byte
+		wantErr    bool
+	}{
+		{name: "round trip", client: sc, objectName: "certcache/shop-tls--shop", ciphertext: ciphertext},
+		{name: "tampered", client: sc, objectName: "certcache/shop-tls--shop", ciphertext: tampered, wantErr: true},
+		{name: "other object name", client: sc, objectName: "certcache/admin-tls--shop", ciphertext: ciphertext, wantErr: true},
+		{name: "other key", client: &S3Client{aead: otherAEAD}, objectName: "certcache/shop-tls--shop", ciphertext: ciphertext, wantErr: true},
+		{name: "too short", client: sc, objectName: "certcache/shop-tls--shop", ciphertext: ciphertext[:4], wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.client.decrypt(tt.objectName, tt.ciphertext)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decrypt() error = %v, want error %t", err, tt.wantErr)
+			}
+			if !tt.wantErr && !bytes.Equal(got, payload) {
+				t.Errorf("decrypt() = %q, want %q", got, payload)
+			}
+		})
+	}
+}
+
+// newTestS3Client connects to the bucket in S3_TEST_ENDPOINT and S3_TEST_BUCKET,
+// e.g. the MinIO from docs/s3_storage.md. Every test gets its own prefix.
+func newTestS3Client(t *testing.T) *S3Client {
+	t.Helper()
+	endpoint := os.Getenv("S3_TEST_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("S3_TEST_ENDPOINT is not set")
+	}
+	bucket := os.Getenv("S3_TEST_BUCKET")
+	if bucket == "" {
+		bucket = "certcache"
+	}
+
+	sc, err := NewS3Client(context.Background(), S3Config{
+		Endpoint:          endpoint,
+		Bucket:            bucket,
+		Prefix:            fmt.Sprintf("test-%d", time.Now().UnixNano()),
+		Insecure:          os.Getenv("S3_TEST_INSECURE") == "true",
+		EncryptionKeyFile: writeEncryptionKey(t, 32),
+		SourceCluster:     "test",
+	})
+	if err != nil {
+		t.Fatalf("failed to create s3 client: %v", err)
+	}
+	return sc
+}
+
+func TestS3Client(t *testing.T) {
+	sc := newTestS3Client(t)
+	ctx := context.Background()
+	notAfter := time.Now().Add(90 * 24 * time.Hour).Truncate(time.Second).UTC()
+	cert, key := testCertificate(t, notAfter)
+	const secretName = "shop-tls--shop"
+
+	exists, err := sc.SecretExists(ctx, secretName)
+	if err != nil || exists {
+		t.Fatalf("SecretExists() before store = %t, %v, want false", exists, err)
+	}
+	_, _, err = sc.GetSecret(ctx, secretName)
+	if !errors.Is(err, certstore.ErrNotFound) {
+		t.Fatalf("GetSecret() before store error = %v, want not found", err)
+	}
+
+	err = sc.StoreSecret(ctx, secretName, cert, key)
+	if err != nil {
+		t.Fatalf("StoreSecret() error = %v", err)
+	}
+	gotCert, gotKey, err := sc.GetSecret(ctx, secretName)
+	if err != nil {
+		t.Fatalf("GetSecret() error = %v", err)
+	}
+	if !bytes.Equal(gotCert, cert) || !bytes.Equal(gotKey, key) {
+		t.Error("GetSecret() does not return the stored certificate and key")
+	}
+	exists, err = sc.SecretExists(ctx, secretName)
+	if err != nil || !exists {
+		t.Errorf("SecretExists() = %t, %v, want true", exists, err)
+	}
+	expiry, err := sc.GetCertificateExpiry(ctx, secretName)
+	if err != nil || !expiry.Equal(notAfter) {
+		t.Errorf("GetCertificateExpiry() = %s, %v, want %s", expiry, err, notAfter)
+	}
+
+	err = sc.DeleteSecret(ctx, secretName)
+	if err != nil {
+		t.Fatalf("DeleteSecret() error = %v", err)
+	}
+	exists, err = sc.SecretExists(ctx, secretName)
+	if err != nil || exists {
+		t.Errorf("SecretExists() after delete = %t, %v, want false", exists, err)
+	}
+	pending, err := sc.ListSecretsPendingPurge(ctx)
+	if err != nil || len(pending) != 1 || pending[0] != secretName {
+		t.Fatalf("ListSecretsPendingPurge() = %v, %v, want [%s]", pending, err, secretName)
+	}
+
+	err = sc.PurgerDeletedSecret(ctx, secretName)
+	if err != nil {
+		t.Fatalf("PurgerDeletedSecret() error = %v", err)
+	}
+	pending, err = sc.ListSecretsPendingPurge(ctx)
+	if err != nil || len(pending) != 0 {
+		t.Errorf("ListSecretsPendingPurge() after purge = %v, %v, want none", pending, err)
+	}
+}
+
+func TestS3ClientStoredAgainIsNotPurged(t *testing.T) {
+	sc := newTestS3Client(t)
+	ctx := context.Background()
+	cert, key := testCertificate(t, time.Now().Add(24*time.Hour))
+	const secretName = "shop-tls--shop"
+	t.Cleanup(func() {
+		_ = sc.DeleteSecret(ctx, secretName)
+		_ = sc.PurgerDeletedSecret(ctx, secretName)
+	})
+
+	for _, step := range []func() error{
+		func() error { return sc.StoreSecret(ctx, secretName, cert, key) },
+		func() error { return sc.DeleteSecret(ctx, secretName) },
+		func() error { return sc.StoreSecret(ctx, secretName, cert, key) },
+	} {
+		if err := step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sc.PurgerDeletedSecret(ctx, secretName); err == nil {
+		t.Error("PurgerDeletedSecret() purged a secret which was stored again")
+	}
+	if _, _, err := sc.GetSecret(ctx, secretName); err != nil {
+		t.Errorf("GetSecret() after refused purge error = %v", err)
+	}
+}
+
+func TestS3ClientCorrupt(t *testing.T) {
+	sc := newTestS3Client(t)
+	ctx := context.Background()
+	notAfter := time.Now().Add(24 * time.Hour).Truncate(time.Second).UTC()
+	cert, key := testCertificate(t, notAfter)
+	t.Cleanup(func() {
+		for _, secretName := range []string{"shop-tls--shop", "copied-tls--shop", "tampered-tls--shop"} {
+			_ = sc.DeleteSecret(ctx, secretName)
+			_ = sc.PurgerDeletedSecret(ctx, secretName)
+		}
+	})
+
+	err := sc.StoreSecret(ctx, "shop-tls--shop", cert, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Ciphertext moved to another entry fails the object name check.
+	_, err = sc.client.CopyObject(ctx,
+		minio.CopyDestOptions{Bucket: sc.bucket, Object: sc.objectName("copied-tls--shop")},
+		minio.CopySrcOptions{Bucket: sc.bucket, Object: sc.objectName("shop-tls--shop")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = sc.GetSecret(ctx, "copied-tls--shop")
+	if !errors.Is(err, certstore.ErrCorrupt) {
+		t.Errorf("GetSecret() of a copied object error = %v, want corrupt", err)
+	}
+	// The expiry comes from the metadata, the object is not decrypted.
+	expiry, err := sc.GetCertificateExpiry(ctx, "copied-tls--shop")
+	if err != nil || !expiry.Equal(notAfter) {
+		t.Errorf("GetCertificateExpiry() of a copied object = %s, %v, want %s", expiry, err, notAfter)
+	}
+
+	tampered := []byte("not a ciphertext of this key")
+	_, err = sc.client.PutObject(ctx, sc.bucket, sc.objectName("tampered-tls--shop"), bytes.NewReader(tampered), int64(len(tampered)), minio.PutObjectOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = sc.GetSecret(ctx, "tampered-tls--shop")
+	if !errors.Is(err, certstore.ErrCorrupt) {
+		t.Errorf("GetSecret() of a tampered object error = %v, want corrupt", err)
+	}
+	_, err = sc.GetCertificateExpiry(ctx, "tampered-tls--shop")
+	if !errors.Is(err, certstore.ErrCorrupt) {
+		t.Errorf("GetCertificateExpiry() without metadata error = %v, want corrupt", err)
+	}
+}
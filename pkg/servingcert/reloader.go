@@ -0,0 +1,117 @@
+package servingcert
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	kwhlog "github.com/slok/kubewebhook/v2/pkg/log"
+)
+
+// Recorder records the serving certificate metrics.
+type Recorder interface {
+	ServingCertificateLoaded(notAfter time.Time)
+	ServingCertificateReloadFailed()
+}
+
+// Reloader serves the certificate of the cert and key files through
+// tls.Config.GetCertificate and reloads it when the files change. Open
+// connections keep the certificate of their handshake, new ones get the new one.
+type Reloader struct {
+	certFile string
+	keyFile  string
+	recorder Recorder
+	logger   kwhlog.Logger
+
+	mu          sync.RWMutex
+	certificate *tls.Certificate
+	certPEM     []byte
+	keyPEM      []byte
+}
+
+// NewReloader loads the certificate, a missing or invalid certificate is an error.
+func NewReloader(certFile, keyFile string, recorder Recorder, logger kwhlog.Logger) (*Reloader, error) {
+	r := &Reloader{certFile: certFile, keyFile: keyFile, recorder: recorder, logger: logger}
+	_, err := r.reload()
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetCertificate returns the current certificate, for tls.Config.GetCertificate.
+func (r *Reloader) GetCertificate(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.certificate, nil
+}
+
+// Run checks the files for changes every interval until ctx is cancelled. Secret
+// volumes are updated by swapping a symlink, so the content is compared rather
+// than watching the files.
+func (r *Reloader) Run(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			reloaded, err := r.reload()
+			if err != nil {
+				r.recorder.ServingCertificateReloadFailed()
+				r.logger.Warningf("Failed to reload serving certificate, keeping the current one: %v", err)
+				continue
+			}
+			if reloaded {
+				r.logger.Infof("Serving certificate %s is reloaded", r.certFile)
+			}
+		}
+	}
+}
+
+// reload loads the files when their content changed since the last attempt.
+// A pair which failed to load is not retried until one of the files changes,
+// e.g. when the key is written after the certificate.
+func (r *Reloader) reload() (bool, error) {
+	certPEM, err := os.ReadFile(r.certFile)
+	if err != nil {
+		return false, fmt.Errorf("failed to read serving certificate: %w", err)
+	}
+	keyPEM, err := os.ReadFile(r.keyFile)
+	if err != nil {
+		return false, fmt.Errorf("failed to read serving key: %w", err)
+	}
+
+	r.mu.RLock()
+	unchanged := bytes.Equal(certPEM, r.certPEM) && bytes.Equal(keyPEM, r.keyPEM)
+	r.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	r.mu.Lock()
+	r.certPEM, r.keyPEM = certPEM, keyPEM
+	r.mu.Unlock()
+
+	certificate, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return false, fmt.Errorf("failed to load serving certificate: %w", err)
+	}
+	leaf, err := x509.ParseCertificate(certificate.Certificate[0])
+	if err != nil {
+		return false, fmt.Errorf("failed to parse serving certificate: %w", err)
+	}
+	certificate.Leaf = leaf
+
+	r.mu.Lock()
+	r.certificate = &certificate
+	r.mu.Unlock()
+	r.recorder.ServingCertificateLoaded(leaf.NotAfter)
+	return true, nil
+}
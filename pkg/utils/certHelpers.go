@@ -20,3 +20,32 @@ func GetFirstCertExpiryFromPEM(certPEM []byte) (time.Time, error) {
 
 	return parsedCert.NotAfter, nil
 }
+
+func GetFirstCertDetailsFromPEM(certPEM []byte) (string, []string, error) {
+	block, _ := pem.Decode(certPEM)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return "", nil, fmt.Errorf("failed to parse certificate PEM")
+	}
+
+	parsedCert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to parse certificate: %w", err)
+	}
+
+	return parsedCert.Subject.CommonName, parsedCert.DNSNames, nil
+}
+
+// GetFirstCertSerialFromPEM returns the hex encoded serial number of the first certificate.
+func GetFirstCertSerialFromPEM(certPEM []byte) (string, error) {
+	block, _ := pem.Decode(certPEM)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return "", fmt.Errorf("failed to parse certificate PEM")
+	}
+
+	parsedCert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse certificate: %w", err)
+	}
+
+	return parsedCert.SerialNumber.Text(16), nil
+}
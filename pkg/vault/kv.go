@@ -0,0 +1,295 @@
+package vaultwrapper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/certstore"
+	"dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/resilience"
+	"dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/utils"
+	vaultapi "github.com/hashicorp/vault/api"
+	vaultk8sauth "github.com/hashicorp/vault/api/auth/kubernetes"
+)
+
+// Supported authentication methods.
+const (
+	AuthMethodToken      = "token"
+	AuthMethodKubernetes = "kubernetes"
+)
+
+const (
+	certField = "tls.crt"
+	keyField  = "tls.key"
+)
+
+// VaultConfig configures the connection to a HashiCorp Vault KV v2 secrets engine.
+type VaultConfig struct {
+	// Address of the Vault server, VAULT_ADDR is used when empty.
+	Address string
+	// MountPath of the KV v2 secrets engine.
+	MountPath string
+	// PathPrefix all cache entries are stored under, may be empty.
+	PathPrefix string
+	// AuthMethod is either "token" (VAULT_TOKEN) or "kubernetes".
+	AuthMethod string
+	// KubernetesRole is the Vault role used by the Kubernetes auth method.
+	KubernetesRole string
+	// KubernetesMountPath of the Kubernetes auth method.
+	KubernetesMountPath string
+}
+
+// VaultClient stores cache entries in a HashiCorp Vault KV v2 secrets engine.
+// Deleting an entry soft deletes its latest version, purging removes the metadata
+// together with all versions, which mirrors the Key Vault soft delete.
+type VaultClient struct {
+	client     *vaultapi.Client
+	kv         *vaultapi.KVv2
+	mountPath  string
+	pathPrefix string
+}
+
+var _ certstore.CertStore = (*VaultClient)(nil)
+
+func NewVaultClient(ctx context.Context, cfg VaultConfig) (*VaultClient, error) {
+	config := vaultapi.DefaultConfig()
+	if config.Error != nil {
+		return nil, fmt.Errorf("failed to read vault configuration: %w", config.Error)
+	}
+	if cfg.Address != "" {
+		config.Address = cfg.Address
+	}
+
+	client, err := vaultapi.NewClient(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create vault client: %w", err)
+	}
+
+	switch cfg.AuthMethod {
+	case AuthMethodToken:
+		if client.Token() == "" {
+			return nil, fmt.Errorf("vault token auth selected but VAULT_TOKEN is not set")
+		}
+	case AuthMethodKubernetes:
+		k8sAuth, err := vaultk8sauth.NewKubernetesAuth(cfg.KubernetesRole, vaultk8sauth.WithMountPath(cfg.KubernetesMountPath))
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize vault kubernetes auth: %w", err)
+		}
+		authInfo, err := client.Auth().Login(ctx, k8sAuth)
+		if err != nil {
+			return nil, fmt.Errorf("failed to login to vault using kubernetes auth: %w", err)
+		}
+		go manageTokenLifecycle(ctx, client, k8sAuth, authInfo)
+	default:
+		return nil, fmt.Errorf("unknown vault auth method %q", cfg.AuthMethod)
+	}
+
+	mountPath := strings.Trim(cfg.MountPath, "/")
+	return &VaultClient{
+		client:     client,
+		kv:         client.KVv2(mountPath),
+		mountPath:  mountPath,
+		pathPrefix: strings.Trim(cfg.PathPrefix, "/"),
+	}, nil
+}
+
+// reloginBackoff spaces the logins of manageTokenLifecycle. Logins are at least
+// Initial apart, also for a token without a lease duration or a watcher which
+// stops right away, failed logins back off up to Max.
+var reloginBackoff = resilience.Backoff{Initial: 10 * time.Second, Max: 5 * time.Minute}
+
+// manageTokenLifecycle keeps renewing the login token and logs in again once it
+// can no longer be renewed, until ctx is cancelled.
+func manageTokenLifecycle(ctx context.Context, client *vaultapi.Client, k8sAuth *vaultk8sauth.KubernetesAuth, authInfo *vaultapi.Secret) {
+	lastLogin := time.Now()
+	failures := 0
+	for {
+		var wait time.Duration
+		switch {
+		case authInfo != nil && authInfo.Auth != nil && authInfo.Auth.Renewable:
+			watcher, err := client.NewLifetimeWatcher(&vaultapi.LifetimeWatcherInput{Secret: authInfo})
+			if err == nil {
+				go watcher.Start()
+				select {
+				case <-watcher.DoneCh():
+				case <-ctx.Done():
+				}
+				watcher.Stop()
+			}
+		case authInfo != nil && authInfo.Auth != nil:
+			wait = time.Duration(authInfo.Auth.LeaseDuration) * time.Second * 2 / 3
+		default:
+			wait = reloginBackoff.Delay(failures)
+		}
+		wait = max(wait, reloginBackoff.Initial-time.Since(lastLogin))
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		var err error
+		authInfo, err = client.Auth().Login(ctx, k8sAuth)
+		lastLogin = time.Now()
+		if err != nil {
+			authInfo = nil
+			failures++
+			continue
+		}
+		failures = 0
+	}
+}
+
+func (vc *VaultClient) secretPath(secretName string) string {
+	return path.Join(vc.pathPrefix, secretName)
+}
+
+func (vc *VaultClient) StoreSecret(ctx context.Context, secretName string, cert, key []byte) error {
+	_, err := vc.kv.Put(ctx, vc.secretPath(secretName), map[string]interface{}{
+		certField: string(cert),
+		keyField:  string(key),
+	})
+	err = typedError(err)
+	if err != nil {
+		return fmt.Errorf("failed to store secret: %w", err)
+	}
+	return nil
+}
+
+func (vc *VaultClient) GetSecret(ctx context.Context, secretName string) ([]byte, []byte, error) {
+	secret, err := vc.kv.Get(ctx, vc.secretPath(secretName))
+	err = typedError(err)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get secret: %w", err)
+	}
+	// Data of a soft deleted version is nil while its metadata is still readable
+	if secret.Data == nil {
+		return nil, nil, certstore.NewError(certstore.ErrNotFound, fmt.Errorf("failed to get secret: %w: %s is deleted", vaultapi.ErrSecretNotFound, secretName))
+	}
+
+	cert, _ := secret.Data[certField].(string)
+	key, _ := secret.Data[keyField].(string)
+	if cert == "" || key == "" {
+		return nil, nil, certstore.NewError(certstore.ErrCorrupt, fmt.Errorf("secret %s does not contain %s and %s", secretName, certField, keyField))
+	}
+	return []byte(cert), []byte(key), nil
+}
+
+func (vc *VaultClient) GetCertificateExpiry(ctx context.Context, secretName string) (time.Time, error) {
+	cert, _, err := vc.GetSecret(ctx, secretName)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get secret: %w", err)
+	}
+
+	expiry, err := utils.GetFirstCertExpiryFromPEM(cert)
+	if err != nil {
+		return time.Time{}, certstore.NewError(certstore.ErrCorrupt, fmt.Errorf("failed to parse certificate: %w", err))
+	}
+
+	return expiry, nil
+}
+
+func (vc *VaultClient) SecretExists(ctx context.Context, secretName string) (bool, error) {
+	_, _, err := vc.GetSecret(ctx, secretName)
+	if errors.Is(err, certstore.ErrNotFound) {
+		return false, nil
+	}
+	// A corrupt entry exists, reading it reports the corruption
+	if err != nil && !errors.Is(err, certstore.ErrCorrupt) {
+		return false, fmt.Errorf("failed to check secret in vault: %w", err)
+	}
+	return true, nil
+}
+
+func (vc *VaultClient) DeleteSecret(ctx context.Context, secretName string) error {
+	//Validate if exist
+	exists, err := vc.SecretExists(ctx, secretName)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return nil
+	}
+
+	//Soft delete latest version
+	err = typedError(vc.kv.Delete(ctx, vc.secretPath(secretName)))
+	if err != nil {
+		return fmt.Errorf("failed to delete secret: %w", err)
+	}
+	return nil
+}
+
+func (vc *VaultClient) ListSecretsPendingPurge(ctx context.Context) ([]string, error) {
+	list, err := vc.client.Logical().ListWithContext(ctx, path.Join(vc.mountPath, "metadata", vc.pathPrefix))
+	err = typedError(err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list secrets: %w", err)
+	}
+	if list == nil {
+		return nil, nil
+	}
+
+	keys, _ := list.Data["keys"].([]interface{})
+	var secretsPendingPurge []string
+	for _, k := range keys {
+		secretName, ok := k.(string)
+		if !ok || strings.HasSuffix(secretName, "/") {
+			continue
+		}
+
+		metadata, err := vc.kv.GetMetadata(ctx, vc.secretPath(secretName))
+		err = typedError(err)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get secret metadata: %w", err)
+		}
+		current, ok := metadata.Versions[fmt.Sprint(metadata.CurrentVersion)]
+		if ok && (!current.DeletionTime.IsZero() || current.Destroyed) {
+			secretsPendingPurge = append(secretsPendingPurge, secretName)
+		}
+	}
+
+	sort.Strings(secretsPendingPurge)
+	return secretsPendingPurge, nil
+}
+
+func (vc *VaultClient) PurgerDeletedSecret(ctx context.Context, secretName string) error {
+	err := typedError(vc.kv.DeleteMetadata(ctx, vc.secretPath(secretName)))
+	if err != nil {
+		return fmt.Errorf("failed to purge secret: %w", err)
+	}
+	return nil
+}
+
+// typedError gives the error of a Vault call its certstore kind. Connection
+// failures and a sealed Vault are unavailable, a cancelled call has no kind.
+func typedError(err error) error {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return err
+	}
+	if errors.Is(err, vaultapi.ErrSecretNotFound) {
+		return certstore.NewError(certstore.ErrNotFound, err)
+	}
+	var respErr *vaultapi.ResponseError
+	if !errors.As(err, &respErr) {
+		return certstore.NewError(certstore.ErrUnavailable, err)
+	}
+	switch {
+	case respErr.StatusCode == http.StatusNotFound:
+		return certstore.NewError(certstore.ErrNotFound, err)
+	case respErr.StatusCode == http.StatusUnauthorized || respErr.StatusCode == http.StatusForbidden:
+		return certstore.NewError(certstore.ErrForbidden, err)
+	case respErr.StatusCode == http.StatusTooManyRequests:
+		return certstore.NewError(certstore.ErrThrottled, err)
+	case respErr.StatusCode >= http.StatusInternalServerError:
+		return certstore.NewError(certstore.ErrUnavailable, err)
+	}
+	return err
+}
@@ -0,0 +1,165 @@
+package vaultwrapper
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+
+	"dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/certstore"
+)
+
+func testCertificate(t *testing.T, notAfter time.Time) ([]byte, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "shop.example.com"},
+		DNSNames:     []string{"shop.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+// newTestVaultClient connects to the Vault in VAULT_ADDR with VAULT_TOKEN, e.g.
+// a local vault server -dev. The KV v2 mount is VAULT_TEST_MOUNT_PATH, secret
+// by default, and every test gets its own path prefix.
+func newTestVaultClient(t *testing.T) *VaultClient {
+	t.Helper()
+	if os.Getenv("VAULT_ADDR") == "" || os.Getenv("VAULT_TOKEN") == "" {
+		t.Skip("VAULT_ADDR and VAULT_TOKEN are not set")
+	}
+	mountPath := os.Getenv("VAULT_TEST_MOUNT_PATH")
+	if mountPath == "" {
+		mountPath = "secret"
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	vc, err := NewVaultClient(ctx, VaultConfig{
+		MountPath:  mountPath,
+		PathPrefix: fmt.Sprintf("certcache-test-%d", time.Now().UnixNano()),
+		AuthMethod: AuthMethodToken,
+	})
+	if err != nil {
+		t.Fatalf("failed to create vault client: %v", err)
+	}
+	return vc
+}
+
+func TestVaultClient(t *testing.T) {
+	vc := newTestVaultClient(t)
+	ctx := context.Background()
+	notAfter := time.Now().Add(90 * 24 * time.Hour).Truncate(time.Second).UTC()
+	cert, key := testCertificate(t, notAfter)
+	const secretName = "shop-tls--shop"
+
+	exists, err := vc.SecretExists(ctx, secretName)
+	if err != nil || exists {
+		t.Fatalf("SecretExists() before store = %t, %v, want false", exists, err)
+	}
+	_, _, err = vc.GetSecret(ctx, secretName)
+	if !errors.Is(err, certstore.ErrNotFound) {
+		t.Fatalf("GetSecret() before store error = %v, want not found", err)
+	}
+
+	err = vc.StoreSecret(ctx, secretName, cert, key)
+	if err != nil {
+		t.Fatalf("StoreSecret() error = %v", err)
+	}
+	gotCert, gotKey, err := vc.GetSecret(ctx, secretName)
+	if err != nil {
+		t.Fatalf("GetSecret() error = %v", err)
+	}
+	if !bytes.Equal(gotCert, cert) || !bytes.Equal(gotKey, key) {
+		t.Error("GetSecret() does not return the stored certificate and key")
+	}
+	exists, err = vc.SecretExists(ctx, secretName)
+	if err != nil || !exists {
+		t.Errorf("SecretExists() = %t, %v, want true", exists, err)
+	}
+	expiry, err := vc.GetCertificateExpiry(ctx, secretName)
+	if err != nil || !expiry.Equal(notAfter) {
+		t.Errorf("GetCertificateExpiry() = %s, %v, want %s", expiry, err, notAfter)
+	}
+	pending, err := vc.ListSecretsPendingPurge(ctx)
+	if err != nil || len(pending) != 0 {
+		t.Errorf("ListSecretsPendingPurge() before delete = %v, %v, want none", pending, err)
+	}
+
+	err = vc.DeleteSecret(ctx, secretName)
+	if err != nil {
+		t.Fatalf("DeleteSecret() error = %v", err)
+	}
+	_, _, err = vc.GetSecret(ctx, secretName)
+	if !errors.Is(err, certstore.ErrNotFound) {
+		t.Errorf("GetSecret() after delete error = %v, want not found", err)
+	}
+	exists, err = vc.SecretExists(ctx, secretName)
+	if err != nil || exists {
+		t.Errorf("SecretExists() after delete = %t, %v, want false", exists, err)
+	}
+	err = vc.DeleteSecret(ctx, secretName)
+	if err != nil {
+		t.Errorf("DeleteSecret() of a deleted secret error = %v", err)
+	}
+	pending, err = vc.ListSecretsPendingPurge(ctx)
+	if err != nil || len(pending) != 1 || pending[0] != secretName {
+		t.Fatalf("ListSecretsPendingPurge() = %v, %v, want [%s]", pending, err, secretName)
+	}
+
+	err = vc.PurgerDeletedSecret(ctx, secretName)
+	if err != nil {
+		t.Fatalf("PurgerDeletedSecret() error = %v", err)
+	}
+	pending, err = vc.ListSecretsPendingPurge(ctx)
+	if err != nil || len(pending) != 0 {
+		t.Errorf("ListSecretsPendingPurge() after purge = %v, %v, want none", pending, err)
+	}
+}
+
+func TestVaultClientCorrupt(t *testing.T) {
+	vc := newTestVaultClient(t)
+	ctx := context.Background()
+	const secretName = "broken-tls--shop"
+	t.Cleanup(func() {
+		_ = vc.DeleteSecret(ctx, secretName)
+		_ = vc.PurgerDeletedSecret(ctx, secretName)
+	})
+
+	_, err := vc.kv.Put(ctx, vc.secretPath(secretName), map[string]interface{}{certField: "not a certificate"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = vc.GetSecret(ctx, secretName)
+	if !errors.Is(err, certstore.ErrCorrupt) {
+		t.Errorf("GetSecret() without a key error = %v, want corrupt", err)
+	}
+	exists, err := vc.SecretExists(ctx, secretName)
+	if err != nil || !exists {
+		t.Errorf("SecretExists() of a corrupt secret = %t, %v, want true", exists, err)
+	}
+}
@@ -0,0 +1,21 @@
+package mutating
+
+import (
+	"context"
+	"time"
+
+	kwhmodel "github.com/slok/kubewebhook/v2/pkg/model"
+	kwhmutating "github.com/slok/kubewebhook/v2/pkg/webhook/mutating"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// withBudget bounds the calls of the mutator by a deadline below the webhook
+// timeout of the API server, so a slow backend fails open with the time left to
+// answer the admission instead of the API server giving up on the webhook.
+func withBudget(budget time.Duration, m kwhmutating.Mutator) kwhmutating.Mutator {
+	return kwhmutating.MutatorFunc(func(ctx context.Context, ar *kwhmodel.AdmissionReview, obj metav1.Object) (*kwhmutating.MutatorResult, error) {
+		ctx, cancel := context.WithTimeout(ctx, budget)
+		defer cancel()
+		return m.Mutate(ctx, ar, obj)
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"strings"
 
+	"dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/plan"
 	acmecertmanager "github.com/cert-manager/cert-manager/pkg/apis/acme/v1"
 	kwhlog "github.com/slok/kubewebhook/v2/pkg/log"
 	kwhmodel "github.com/slok/kubewebhook/v2/pkg/model"
@@ -14,6 +15,7 @@ import (
 // CertOrderMutateWebhook fixing issue with order state on ZeroSSL
 type certOrderMutator struct {
 	logger kwhlog.Logger
+	plan   *plan.Plan
 }
 
 func (m *certOrderMutator) Mutate(_ context.Context, _ *kwhmodel.AdmissionReview, obj metav1.Object) (*kwhmutating.MutatorResult, error) {
@@ -22,6 +24,10 @@ func (m *certOrderMutator) Mutate(_ context.Context, _ *kwhmodel.AdmissionReview
 		return &kwhmutating.MutatorResult{}, nil
 	}
 	if chalange.Status.State == acmecertmanager.Errored && strings.Contains(chalange.Status.Reason, "429") {
+		if m.plan.Enabled() {
+			m.plan.Record("certOrderMutator", plan.OperationMutate, "challenge "+chalange.Namespace+"/"+chalange.Name, "reset state to pending")
+			return &kwhmutating.MutatorResult{}, nil
+		}
 		chalange.Status.State = acmecertmanager.Pending
 		chalange.Status.Reason = "Mutated by DrMax admission webhook, bacause previous order ended up in error state due to ZeroSSL nginx proxy overload (due error)"
 		m.logger.Infof("--- MUTATED --- Challenge %s is mutated back to pending state", chalange.Name)
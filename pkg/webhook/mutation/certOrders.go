@@ -1,15 +1,16 @@
 package mutating
 
 import (
+	"dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/plan"
 	acmecertmanager "github.com/cert-manager/cert-manager/pkg/apis/acme/v1"
 	kwhlog "github.com/slok/kubewebhook/v2/pkg/log"
 	kwhwebhook "github.com/slok/kubewebhook/v2/pkg/webhook"
 	kwhmutating "github.com/slok/kubewebhook/v2/pkg/webhook/mutating"
 )
 
-func CertOrderMutateWebhook(logger kwhlog.Logger) (kwhwebhook.Webhook, error) {
+func CertOrderMutateWebhook(logger kwhlog.Logger, p *plan.Plan) (kwhwebhook.Webhook, error) {
 	mutators := []kwhmutating.Mutator{
-		&certOrderMutator{logger: logger},
+		&certOrderMutator{logger: logger, plan: p},
 	}
 
 	return kwhmutating.NewWebhook(kwhmutating.WebhookConfig{
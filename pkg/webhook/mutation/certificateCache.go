@@ -1,15 +1,32 @@
 package mutating
 
 import (
+	"time"
+
+	"dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/certcacheclient"
+	"dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/certificatecache"
+	"dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/certstore"
+	"dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/metrics"
+	"dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/plan"
 	certmanager "github.com/jetstack/cert-manager/pkg/apis/certmanager/v1"
 	kwhlog "github.com/slok/kubewebhook/v2/pkg/log"
 	kwhwebhook "github.com/slok/kubewebhook/v2/pkg/webhook"
 	kwhmutating "github.com/slok/kubewebhook/v2/pkg/webhook/mutating"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	networkinglisters "k8s.io/client-go/listers/networking/v1"
+	"k8s.io/client-go/tools/record"
 )
 
-func CertificateCacheMutateWebhook(logger kwhlog.Logger, keyVaultName string) (kwhwebhook.Webhook, error) {
+// metricsWebhookCertificateCache labels the cache lookups of the webhook.
+const metricsWebhookCertificateCache = "certificatecache"
+
+// CertificateCacheMutateWebhook reads the Ingress of a Certificate and the Namespace
+// of its cache policy from the listers, synced informers keep admissions off the API server. Every admission
+// is bounded by the budget, which has to stay below the webhook timeoutSeconds.
+func CertificateCacheMutateWebhook(logger kwhlog.Logger, budget time.Duration, k8sClient kubernetes.Interface, ingresses networkinglisters.IngressLister, namespaces corelisters.NamespaceLister, certStore certstore.CertStore, cacheClient *certcacheclient.Client, metricsRec *metrics.Recorder, recorder record.EventRecorder, policy certificatecache.Policy, p *plan.Plan) (kwhwebhook.Webhook, error) {
 	mutators := []kwhmutating.Mutator{
-		&certificateCaheMutator{logger: logger, keyVaultName: keyVaultName},
+		withBudget(budget, &certificateCaheMutator{logger: logger, k8sClient: k8sClient, ingresses: ingresses, namespaces: namespaces, certStore: certStore, cacheClient: cacheClient, metrics: metricsRec, recorder: recorder, policy: policy, plan: p}),
 	}
 
 	return kwhmutating.NewWebhook(kwhmutating.WebhookConfig{
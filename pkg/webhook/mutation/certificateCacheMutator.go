@@ -2,68 +2,110 @@ package mutating
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"time"
 
-	azurewrapper "dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/azure"
-	"dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/k8s"
+	"dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/apis/certcache/v1alpha1"
+	"dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/certcacheclient"
+	"dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/certificatecache"
+	"dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/certstore"
+	"dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/metrics"
+	"dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/plan"
 	certmanager "github.com/jetstack/cert-manager/pkg/apis/certmanager/v1"
 	cmmeta "github.com/jetstack/cert-manager/pkg/apis/meta/v1"
 	kwhlog "github.com/slok/kubewebhook/v2/pkg/log"
 	kwhmodel "github.com/slok/kubewebhook/v2/pkg/model"
 	kwhmutating "github.com/slok/kubewebhook/v2/pkg/webhook/mutating"
+	corev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	networkinglisters "k8s.io/client-go/listers/networking/v1"
+	"k8s.io/client-go/tools/record"
 )
 
 type certificateCaheMutator struct {
-	logger       kwhlog.Logger
-	keyVaultName string
+	logger      kwhlog.Logger
+	k8sClient   kubernetes.Interface
+	ingresses   networkinglisters.IngressLister
+	namespaces  corelisters.NamespaceLister
+	certStore   certstore.CertStore
+	cacheClient *certcacheclient.Client
+	metrics     *metrics.Recorder
+	recorder    record.EventRecorder
+	policy      certificatecache.Policy
+	plan        *plan.Plan
 }
 
-func (m *certificateCaheMutator) Mutate(_ context.Context, _ *kwhmodel.AdmissionReview, obj metav1.Object) (*kwhmutating.MutatorResult, error) {
+func (m *certificateCaheMutator) Mutate(ctx context.Context, ar *kwhmodel.AdmissionReview, obj metav1.Object) (*kwhmutating.MutatorResult, error) {
 	cert, ok := obj.(*certmanager.Certificate)
-	azureKv, _ := azurewrapper.NewKeyVaultClient(m.keyVaultName)
 	if !ok {
 		return &kwhmutating.MutatorResult{}, nil
 	}
-	k8sRestClient, err := k8s.PrepareInClusterK8SClient()
+	ingress, err := m.findIngress(ctx, cert)
 	if err != nil {
-		m.logger.Errorf("Error creating k8s rest client: %v", err)
-		return &kwhmutating.MutatorResult{}, nil
-	}
-	k8sClient, err := kubernetes.NewForConfig(k8sRestClient)
-	if err != nil {
-		m.logger.Errorf("Error creating k8s client: %v", err)
-		return &kwhmutating.MutatorResult{}, nil
-	}
-
-	// Check if the certificate has ownerReferences pointing to an Ingress
-	var ingress *v1.Ingress
-	for _, ownerRef := range cert.GetOwnerReferences() {
-		if ownerRef.Kind == "Ingress" {
-			ingress, err = k8sClient.NetworkingV1().Ingresses(cert.Namespace).Get(context.TODO(), ownerRef.Name, metav1.GetOptions{})
-			if err != nil {
-				m.logger.Errorf("Error getting Ingress object: %v", err)
-				return &kwhmutating.MutatorResult{}, err
-			}
-			break
-		}
+		m.logger.Errorf("Error getting Ingress object: %v", err)
+		return &kwhmutating.MutatorResult{}, err
 	}
 	if ingress == nil {
-		m.logger.Infof("Certificate %s in namespace %s does not have an Ingress owner reference, skipping mutation", cert.Name, cert.Namespace)
+		m.logger.Infof("Certificate %s in namespace %s is not used by any Ingress, skipping mutation", cert.Name, cert.Namespace)
 		return &kwhmutating.MutatorResult{}, nil
 	}
 
-	if ingress.Annotations["admissions.drmax.gl/cache-certs"] != "true" {
+	if !certificatecache.CachingEnabled(ingress) {
 		m.logger.Infof("Ingress %s in namespace %s does not have the required annotation, skipping mutation", ingress.Name, ingress.Namespace)
 		return &kwhmutating.MutatorResult{}, nil
 	}
 
-	exist, err := azureKv.SecretExists(context.TODO(), cert.Name+"--"+cert.Namespace)
+	// The cache is keyed by the TLS secret, which does not have to match the Certificate name
+	cacheKey := certificatecache.CacheKey(cert.Spec.SecretName, cert.Namespace)
+	exist, err := m.certStore.SecretExists(ctx, cacheKey)
 	if err != nil {
-		m.logger.Errorf("Error checking if certificate is ready: %v", err)
+		// Fail open without counting a miss, cert-manager issues the certificate
+		if certstore.IsTransient(err) {
+			m.logger.Warningf("Cache backend is unavailable, certificate %s in namespace %s will be issued by cert-manager: %v", cert.Name, cert.Namespace, err)
+		} else {
+			m.logger.Errorf("Error looking up certificate %s in namespace %s in cache: %v", cert.Name, cert.Namespace, err)
+			if ar == nil || !ar.DryRun {
+				certificatecache.RecordEvent(m.recorder, ingress, cert, corev1.EventTypeWarning, v1alpha1.ReasonBackendError, "Failed to look up secret %s in cache: %v", cert.Spec.SecretName, err)
+			}
+		}
+		return &kwhmutating.MutatorResult{
+			Warnings: []string{fmt.Sprintf("certificate cache lookup of %s failed, the certificate is issued by cert-manager", cacheKey)},
+		}, nil
 	}
+	m.metrics.Lookup(metricsWebhookCertificateCache, exist)
 	if exist {
+		expiry, err := m.certStore.GetCertificateExpiry(ctx, cacheKey)
+		switch {
+		case errors.Is(err, certstore.ErrNotFound):
+			m.logger.Infof("Certificate %s in namespace %s was evicted from cache meanwhile. Certificate will be issued by cert-manager", cert.Name, cert.Namespace)
+			return &kwhmutating.MutatorResult{}, nil
+		case errors.Is(err, certstore.ErrCorrupt):
+			m.logger.Errorf("Cached certificate %s can not be read: %v", cacheKey, err)
+			if ar == nil || !ar.DryRun {
+				certificatecache.RecordEvent(m.recorder, ingress, cert, corev1.EventTypeWarning, v1alpha1.ReasonCorrupt, "Secret %s can not be read from cache and is not restored: %v", cert.Spec.SecretName, err)
+			}
+			return &kwhmutating.MutatorResult{}, nil
+		case err != nil:
+			m.logger.Errorf("Error getting certificate expiry: %v", err)
+			return &kwhmutating.MutatorResult{}, nil
+		}
+		policy, err := certificatecache.ResolvePolicy(ctx, m.k8sClient, m.namespaces, m.policy, ingress)
+		if err != nil {
+			m.logger.Warningf("Error resolving cache policy: %v", err)
+		}
+		if remaining := time.Until(expiry); remaining < policy.RestoreMinValidity {
+			m.logger.Infof("Certificate %s in namespace %s is found in cache but expires in %s, less than the minimum validity %s to restore. Certificate will be issued by cert-manager", cert.Name, cert.Namespace, remaining.Round(time.Minute), policy.RestoreMinValidity)
+			return &kwhmutating.MutatorResult{
+				Warnings: []string{fmt.Sprintf("cached certificate %s expires at %s and is not restored", cacheKey, expiry.Format(time.RFC3339))},
+			}, nil
+		}
+
 		m.logger.Debugf("Certificate %s in namespace %s is found in cache and will be used generated as Secret and Certificate object", cert.Name, cert.Namespace)
 		cert.Status.Conditions = append(cert.Status.Conditions, certmanager.CertificateCondition{
 			Type:    certmanager.CertificateConditionReady,
@@ -71,25 +113,88 @@ func (m *certificateCaheMutator) Mutate(_ context.Context, _ *kwhmodel.Admission
 			Reason:  "Cached",
 			Message: "Certificate is cached",
 		})
-		expiry, err := azureKv.GetCertificateExpiry(context.TODO(), cert.Name+"--"+cert.Namespace)
-		if err != nil {
-			m.logger.Errorf("Error getting certificate expiry: %v", err)
+		cert.Status.RenewalTime = &metav1.Time{Time: expiry.Add(-policy.RenewBefore)}
+		if ar != nil && ar.DryRun {
+			return &kwhmutating.MutatorResult{MutatedObject: cert}, nil
 		}
-		cert.Status.RenewalTime = &metav1.Time{Time: expiry.AddDate(0, 0, -14)}
-		err = azureKv.SaveSecretToK8s(context.TODO(), cert.Name+"--"+cert.Namespace, cert.Spec.SecretName, cert.Namespace)
+		if m.plan.Enabled() {
+			m.plan.Record("certificateCaheMutator", plan.OperationCreateSecret, cert.Namespace+"/"+cert.Spec.SecretName, "restore from cache key "+cacheKey)
+			m.plan.Record("certificateCaheMutator", plan.OperationMutate, "certificate "+cert.Namespace+"/"+cert.Name, "set Ready condition, renewal time "+cert.Status.RenewalTime.Format(time.RFC3339))
+			return &kwhmutating.MutatorResult{}, nil
+		}
+		err = certstore.SaveSecretToK8s(ctx, m.certStore, m.k8sClient, cacheKey, cert.Spec.SecretName, cert.Name, cert.Namespace)
 		if err != nil {
 			m.logger.Errorf("Error saving secret to k8s: %v", err)
+			switch {
+			case errors.Is(err, certstore.ErrCorrupt):
+				certificatecache.RecordEvent(m.recorder, ingress, cert, corev1.EventTypeWarning, v1alpha1.ReasonCorrupt, "Secret %s can not be read from cache and is not restored: %v", cert.Spec.SecretName, err)
+			case !certstore.IsTransient(err):
+				certificatecache.RecordEvent(m.recorder, ingress, cert, corev1.EventTypeWarning, v1alpha1.ReasonBackendError, "Failed to restore secret %s from cache: %v", cert.Spec.SecretName, err)
+			}
+			return &kwhmutating.MutatorResult{}, nil
+		}
+		ref := certcacheclient.Ref{
+			Namespace:       cert.Namespace,
+			SecretName:      cert.Spec.SecretName,
+			IngressName:     ingress.Name,
+			IngressUID:      ingress.UID,
+			CertificateName: cert.Name,
 		}
-		if cert.Annotations == nil {
-			cert.Annotations = make(map[string]string)
+		err = m.cacheClient.UpdateStatus(ctx, ref, v1alpha1.PhaseCached, v1alpha1.ReasonRestored, "Certificate is restored from cache",
+			func(status *v1alpha1.CertificateCacheStatus) {
+				now := metav1.Now()
+				status.LastSyncTime = &now
+				status.BackendKey = cacheKey
+				status.NotAfter = &metav1.Time{Time: expiry}
+			})
+		if err != nil {
+			m.logger.Errorf("Error updating certificate cache status: %v", err)
 		}
-		cert.Annotations["admissions.drmax.gl/cert-cached"] = "true"
-		cert.Annotations["admissions.drmax.gl/cert-cache-name"] = cert.Name + "--" + cert.Namespace
-		cert.Annotations["admissions.drmax.gl/cert-cache-namespace"] = cert.Namespace
-		cert.Annotations["admissions.drmax.gl/time-of-sync"] = metav1.Now().String()
-		m.logger.Infof(" -- MUTATED -- Certificate %s in namespace %s is loaded from KeyVault!", cert.Name, cert.Namespace)
+		certificatecache.RecordEvent(m.recorder, ingress, cert, corev1.EventTypeNormal, v1alpha1.ReasonRestored, "Secret %s is restored from cache, certificate expires at %s", cert.Spec.SecretName, expiry.Format(time.RFC3339))
+		m.logger.Infof(" -- MUTATED -- Certificate %s in namespace %s is loaded from cache!", cert.Name, cert.Namespace)
 
 		return &kwhmutating.MutatorResult{MutatedObject: cert}, nil
 	}
 	return &kwhmutating.MutatorResult{}, nil
 }
+
+// findIngress returns the Ingress owning the certificate, or for Certificates
+// created separately the Ingress referencing its secret in spec.tls. The Ingress
+// is shared with the informer cache and must not be modified.
+func (m *certificateCaheMutator) findIngress(ctx context.Context, cert *certmanager.Certificate) (*v1.Ingress, error) {
+	for _, ownerRef := range cert.GetOwnerReferences() {
+		if ownerRef.Kind == "Ingress" {
+			ingress, err := m.ingresses.Ingresses(cert.Namespace).Get(ownerRef.Name)
+			if apierrors.IsNotFound(err) {
+				// ingress-shim creates the Certificate right after the Ingress, the informer may not have seen it yet
+				return m.k8sClient.NetworkingV1().Ingresses(cert.Namespace).Get(ctx, ownerRef.Name, metav1.GetOptions{})
+			}
+			return ingress, err
+		}
+	}
+
+	ingresses, err := m.ingresses.Ingresses(cert.Namespace).List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	return selectIngressForCertificate(ingresses, cert), nil
+}
+
+// selectIngressForCertificate picks the caching enabled Ingress using the certificate secret.
+func selectIngressForCertificate(ingresses []*v1.Ingress, cert *certmanager.Certificate) *v1.Ingress {
+	var found *v1.Ingress
+	for _, ingress := range ingresses {
+		for _, secretName := range certificatecache.TLSSecretNames(ingress) {
+			if secretName != cert.Spec.SecretName {
+				continue
+			}
+			if certificatecache.CachingEnabled(ingress) {
+				return ingress
+			}
+			if found == nil {
+				found = ingress
+			}
+		}
+	}
+	return found
+}
@@ -1,15 +1,27 @@
 package mutating
 
 import (
+	"time"
+
+	certmanagerwrapper "dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/cert-manager-wrapper"
+	"dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/certcacheclient"
+	"dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/certstore"
+	"dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/metrics"
 	kwhlog "github.com/slok/kubewebhook/v2/pkg/log"
 	kwhwebhook "github.com/slok/kubewebhook/v2/pkg/webhook"
 	kwhmutating "github.com/slok/kubewebhook/v2/pkg/webhook/mutating"
 	v1 "k8s.io/api/networking/v1"
+	"k8s.io/client-go/tools/record"
 )
 
-func IngressCertsMutateWebhook(logger kwhlog.Logger, keyVaultName string) (kwhwebhook.Webhook, error) {
+// metricsWebhookIngressCerts labels the cache lookups of the webhook.
+const metricsWebhookIngressCerts = "ingresscerts"
+
+// IngressCertsMutateWebhook bounds every admission by the budget, which has to
+// stay below the timeoutSeconds of the webhook configuration.
+func IngressCertsMutateWebhook(logger kwhlog.Logger, budget time.Duration, certStore certstore.CertStore, cacheClient *certcacheclient.Client, certManager *certmanagerwrapper.CertManagerClient, metricsRec *metrics.Recorder, recorder record.EventRecorder) (kwhwebhook.Webhook, error) {
 	mutators := []kwhmutating.Mutator{
-		&ingressCertsMutator{logger: logger, keyVaultName: keyVaultName},
+		withBudget(budget, &ingressCertsMutator{logger: logger, certStore: certStore, cacheClient: cacheClient, certManager: certManager, metrics: metricsRec, recorder: recorder}),
 	}
 
 	return kwhmutating.NewWebhook(kwhmutating.WebhookConfig{
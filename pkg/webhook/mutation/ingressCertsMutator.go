@@ -2,55 +2,115 @@ package mutating
 
 import (
 	"context"
+	"fmt"
 
-	azurewrapper "dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/azure"
+	"dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/apis/certcache/v1alpha1"
 	certmanagerwrapper "dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/cert-manager-wrapper"
+	"dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/certcacheclient"
+	"dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/certificatecache"
+	"dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/certstore"
+	"dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/metrics"
 	kwhlog "github.com/slok/kubewebhook/v2/pkg/log"
 	kwhmodel "github.com/slok/kubewebhook/v2/pkg/model"
 	kwhmutating "github.com/slok/kubewebhook/v2/pkg/webhook/mutating"
+	corev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/api/networking/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
 )
 
+// ingressCertsMutator records the cache state of every TLS secret in a
+// CertificateCache resource. The Ingress itself is never mutated.
 type ingressCertsMutator struct {
-	logger       kwhlog.Logger
-	keyVaultName string
+	logger      kwhlog.Logger
+	certStore   certstore.CertStore
+	cacheClient *certcacheclient.Client
+	certManager *certmanagerwrapper.CertManagerClient
+	metrics     *metrics.Recorder
+	recorder    record.EventRecorder
 }
 
-func (m *ingressCertsMutator) Mutate(_ context.Context, _ *kwhmodel.AdmissionReview, obj metav1.Object) (*kwhmutating.MutatorResult, error) {
+func (m *ingressCertsMutator) Mutate(ctx context.Context, ar *kwhmodel.AdmissionReview, obj metav1.Object) (*kwhmutating.MutatorResult, error) {
 	ingressObj, ok := obj.(*v1.Ingress)
-	azureKv, _ := azurewrapper.NewKeyVaultClient(m.keyVaultName)
-	if !ok {
+	if !ok || !certificatecache.CachingEnabled(ingressObj) {
 		return &kwhmutating.MutatorResult{}, nil
 	}
-	if ingressObj.Annotations["admissions.drmax.gl/cache-certs"] == "true" && ingressObj.Annotations["admissions.drmax.gl/cert-scheduled-for-save"] != "true" && ingressObj.Annotations["admissions.drmax.gl/cert-cached"] != "true" {
-		existCacheKey, err := azureKv.SecretExists(context.TODO(), ingressObj.Spec.TLS[0].SecretName+"--"+ingressObj.Namespace)
+
+	secretNames := certificatecache.TLSSecretNames(ingressObj)
+	if len(secretNames) == 0 {
+		m.logger.Warningf("Ingress %s in namespace %s has cache-certs annotation but no TLS secret, nothing to cache", ingressObj.Name, ingressObj.Namespace)
+		return &kwhmutating.MutatorResult{
+			Warnings: []string{fmt.Sprintf("ingress %s has %s annotation but no spec.tls secret, certificates will not be cached", ingressObj.Name, certificatecache.CacheCertsAnnotation)},
+		}, nil
+	}
+	if ar != nil && ar.DryRun {
+		return &kwhmutating.MutatorResult{}, nil
+	}
+
+	for _, secretName := range secretNames {
+		cc, err := m.cacheClient.Get(ctx, ingressObj.Namespace, secretName)
 		if err != nil {
-			m.logger.Errorf("Error checking if certificate is ready: %v", err)
+			m.logger.Errorf("Error getting certificate cache: %v", err)
+			continue
 		}
-		if existCacheKey {
-			m.logger.Infof("Ingress %s in namespace %s has cache-certs annotation. Certificate is already cached!", ingressObj.Name, ingressObj.Namespace)
-			ingressObj.Annotations["admissions.drmax.gl/cert-cached"] = "true"
-			return &kwhmutating.MutatorResult{MutatedObject: ingressObj}, nil
+		if cc != nil {
+			continue
 		}
-		m.logger.Debugf("Ingress %s in namespace %s has cache-certs annotation. checking if certificate is issued!", ingressObj.Name, ingressObj.Namespace)
-		certManagerClient, err := certmanagerwrapper.NewCertManagerClient()
-		if err != nil {
-			m.logger.Errorf("failed to create cert-manager client: %v", err)
-			return &kwhmutating.MutatorResult{}, nil
+
+		ref := certcacheclient.Ref{
+			Namespace:   ingressObj.Namespace,
+			SecretName:  secretName,
+			IngressName: ingressObj.Name,
+			IngressUID:  ingressObj.UID,
 		}
-		existReady, err := certManagerClient.CheckIfCertificateIsReady(ingressObj.Spec.TLS[0].SecretName, ingressObj.Namespace)
+		cacheKey := certificatecache.CacheKey(secretName, ingressObj.Namespace)
+		existCacheKey, err := m.certStore.SecretExists(ctx, cacheKey)
 		if err != nil {
-			m.logger.Errorf("Error checking if certificate is ready: %v", err)
+			// Not counted as a miss, the reconciler schedules the secret once it sees the Ingress
+			if certstore.IsTransient(err) {
+				m.logger.Warningf("Cache backend is unavailable, skipping certificate %s of ingress %s in namespace %s: %v", secretName, ingressObj.Name, ingressObj.Namespace, err)
+			} else {
+				m.logger.Errorf("Error looking up certificate %s in cache: %v", secretName, err)
+				certificatecache.RecordEvent(m.recorder, ingressObj, nil, corev1.EventTypeWarning, v1alpha1.ReasonBackendError, "Failed to look up secret %s in cache: %v", secretName, err)
+			}
+			continue
 		}
-		if existReady && ingressObj.Annotations["admissions.drmax.gl/cert-cached"] != "true" {
-			m.logger.Debugf("Certificate for ingress %s in namespace %s is ready. Marking this ingress and certificate for save to cache", ingressObj.Name, ingressObj.Namespace)
-			ingressObj.Annotations["admissions.drmax.gl/cert-scheduled-for-save"] = "true"
-			m.logger.Infof(" -- MUTATED -- Ingress %s in namespace %s is marked for saving certificate to cache in next periodical iteration!", ingressObj.Name, ingressObj.Namespace)
-			return &kwhmutating.MutatorResult{MutatedObject: ingressObj}, nil
-		} else {
-			m.logger.Infof("Certificate for ingress %s in namespace %s is not ready or already loaded from cache!", ingressObj.Name, ingressObj.Namespace)
+		m.metrics.Lookup(metricsWebhookIngressCerts, existCacheKey)
+		if existCacheKey {
+			m.logger.Infof("Ingress %s in namespace %s has cache-certs annotation. Certificate %s is already cached!", ingressObj.Name, ingressObj.Namespace, secretName)
+			err = m.cacheClient.UpdateStatus(ctx, ref, v1alpha1.PhaseCached, v1alpha1.ReasonFoundInCache, "Certificate is already stored in cache",
+				func(status *v1alpha1.CertificateCacheStatus) {
+					status.BackendKey = cacheKey
+				})
+			if err != nil {
+				m.logger.Errorf("Error updating certificate cache status: %v", err)
+			}
+			continue
 		}
+
+		m.logger.Debugf("Ingress %s in namespace %s has cache-certs annotation. checking if certificate %s is issued!", ingressObj.Name, ingressObj.Namespace, secretName)
+		certificate, existReady, err := m.certManager.CheckIfSecretCertificateIsReady(ctx, secretName, ingressObj.Namespace, ingressObj.Name)
+		if err != nil && !certmanagerwrapper.IsNotIssued(err) {
+			m.logger.Errorf("Error checking if certificate %s is ready: %v", secretName, err)
+			continue
+		}
+		if !existReady {
+			m.logger.Infof("Certificate %s for ingress %s in namespace %s is not ready or already loaded from cache!", secretName, ingressObj.Name, ingressObj.Namespace)
+			continue
+		}
+
+		m.logger.Debugf("Certificate %s for ingress %s in namespace %s is ready. Marking this certificate for save to cache", secretName, ingressObj.Name, ingressObj.Namespace)
+		if certificate != nil {
+			ref.CertificateName = certificate.Name
+		}
+		err = m.cacheClient.UpdateStatus(ctx, ref, v1alpha1.PhaseScheduled, v1alpha1.ReasonScheduled, "Certificate is ready and scheduled for save to cache", nil)
+		if err != nil {
+			m.logger.Errorf("Error updating certificate cache status: %v", err)
+			continue
+		}
+		certificatecache.RecordEvent(m.recorder, ingressObj, certificate, corev1.EventTypeNormal, v1alpha1.ReasonScheduled, "Secret %s is scheduled for save to cache", secretName)
+		m.logger.Infof(" -- MARKED -- Certificate %s of ingress %s in namespace %s is scheduled for saving to cache!", secretName, ingressObj.Name, ingressObj.Namespace)
 	}
+
 	return &kwhmutating.MutatorResult{}, nil
 }
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	certmanagerwrapper "dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/cert-manager-wrapper"
+	"dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/certcacheclient"
+	"dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/k8s"
+	"dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/replay"
+	mutating "dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/webhook/mutation"
+	validating "dev.azure.com/drmaxglobal/devops-team/_git/k8s-system-operator/pkg/webhook/validation"
+	kwhwebhook "github.com/slok/kubewebhook/v2/pkg/webhook"
+)
+
+// replay runs AdmissionReview files through the webhooks without a cluster. The
+// webhooks look up the fixtures through fake clients and an in-memory cache.
+func (m *Main) replay(ctx context.Context) error {
+	var fixturePaths []string
+	if m.flags.Fixtures != "" {
+		fixturePaths = strings.Split(m.flags.Fixtures, ",")
+	}
+	fixtures, err := replay.LoadFixtures(fixturePaths...)
+	if err != nil {
+		return err
+	}
+	clients, err := fixtures.NewClients()
+	if err != nil {
+		return err
+	}
+
+	// The webhooks read from listers as in serve, the informers list the fixtures
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	informers := k8s.NewInformers(clients.KubeClient, clients.CertManager, 0)
+	go informers.Run(ctx)
+	err = informers.WaitForCacheSync(ctx)
+	if err != nil {
+		return err
+	}
+
+	webhooks, err := m.replayWebhooks(clients, informers)
+	if err != nil {
+		return err
+	}
+
+	results := make([]replay.Result, 0, len(m.flags.Reviews))
+	for _, file := range m.flags.Reviews {
+		ar, err := replay.LoadReview(file)
+		if err != nil {
+			return err
+		}
+
+		name := m.flags.Webhook
+		if name == "" && ar.RequestGVK != nil {
+			name = replay.WebhookForKind(ar.RequestGVK.Kind)
+		}
+		webhook, ok := webhooks[name]
+		if !ok {
+			return fmt.Errorf("no webhook for admission review %s, set --webhook", file)
+		}
+
+		result := replay.Review(ctx, name, webhook, ar)
+		result.File = file
+		result.Writes = clients.Writes()
+		results = append(results, result)
+	}
+
+	if m.flags.Output == outputJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(results)
+	}
+	for _, result := range results {
+		printReplayResult(result)
+	}
+	return nil
+}
+
+// replayWebhooks builds the webhooks of serve on top of the fake clients.
+func (m *Main) replayWebhooks(clients *replay.Clients, informers *k8s.Informers) (map[string]kwhwebhook.Webhook, error) {
+	cacheClient := certcacheclient.NewForDynamic(clients.Dynamic)
+	certManager := certmanagerwrapper.NewCertManagerClientFromClientset(clients.CertManager, clients.KubeClient).WithListers(informers.Certificates, informers.TLSSecrets)
+
+	certOrderMutator, err := mutating.CertOrderMutateWebhook(m.logger, nil)
+	if err != nil {
+		return nil, err
+	}
+	ingressCertsMutator, err := mutating.IngressCertsMutateWebhook(m.logger, m.flags.MutationTimeout, clients.CertStore, cacheClient, certManager, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	certificateCacheMutator, err := mutating.CertificateCacheMutateWebhook(m.logger, m.flags.MutationTimeout, clients.KubeClient, informers.Ingresses, informers.Namespaces, clients.CertStore, cacheClient, nil, nil, m.flags.CachePolicy, nil)
+	if err != nil {
+		return nil, err
+	}
+	deploymentReplicasValidator, err := validating.NewDeploymentWebhook(minReps, maxReps, m.logger)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]kwhwebhook.Webhook{
+		replay.WebhookCertOrder:        certOrderMutator,
+		replay.WebhookIngressCerts:     ingressCertsMutator,
+		replay.WebhookCertificateCache: certificateCacheMutator,
+		replay.WebhookDeployment:       deploymentReplicasValidator,
+	}, nil
+}
+
+func printReplayResult(result replay.Result) {
+	fmt.Printf("== %s: %s %s %s %s/%s\n", result.File, result.Webhook, result.Operation, result.Kind, result.Namespace, result.Name)
+	if result.Error != "" {
+		fmt.Printf("error: %s\n\n", result.Error)
+		return
+	}
+	fmt.Printf("allowed: %t\n", result.Allowed)
+	if result.Message != "" {
+		fmt.Printf("message: %s\n", result.Message)
+	}
+	for _, warning := range result.Warnings {
+		fmt.Printf("warning: %s\n", warning)
+	}
+	if result.Patch != nil {
+		patch, err := json.MarshalIndent(result.Patch, "", "  ")
+		if err != nil {
+			patch = result.Patch
+		}
+		fmt.Printf("patch:\n%s\n", patch)
+	} else {
+		fmt.Println("patch: none")
+	}
+	for _, write := range result.Writes {
+		fmt.Printf("write: %s\n", write)
+	}
+	fmt.Println()
+}